@@ -12,6 +12,9 @@ import (
 	"github.com/bonnefoa/pg_buffer_viz/pkg/bufferviz"
 	"github.com/bonnefoa/pg_buffer_viz/pkg/db"
 	"github.com/bonnefoa/pg_buffer_viz/pkg/httpserver"
+	"github.com/bonnefoa/pg_buffer_viz/pkg/layout"
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/bonnefoa/pg_buffer_viz/pkg/page"
 	"github.com/bonnefoa/pg_buffer_viz/pkg/render"
 	"github.com/bonnefoa/pg_buffer_viz/pkg/util"
 	"github.com/rotisserie/eris"
@@ -38,11 +41,266 @@ func versionFun(cmd *cobra.Command, args []string) {
 	os.Exit(0)
 }
 
+func configureBufferViz(b *bufferviz.BufferViz) {
+	var err error
+	b.MaxCells = util.GetMaxCells()
+	b.BrinIndex = viper.GetString("brin-index")
+	b.ShowBloat = viper.GetBool("show-bloat")
+	b.ShowRecommendations = viper.GetBool("show-recommendations")
+	b.Layout, err = layout.GetLayout(util.GetLayoutName())
+	if err != nil {
+		logrus.Fatalf("Error configuring layout: %s", eris.ToString(err, true))
+	}
+}
+
+// getOutput returns the output filename, defaulting to an output file with
+// the format's extension
+func getOutput(extension string) string {
+	output := viper.GetString("output")
+	if output == "" {
+		output = fmt.Sprintf("output.%s", extension)
+	}
+	return output
+}
+
+// newRenderer returns the renderer for the output format and the function
+// closing the output
+func newRenderer(format string, output string) (bufferviz.Renderer, func()) {
+	switch format {
+	case "svg":
+		canvas := render.NewCanvasFile(output)
+		b := bufferviz.NewBufferViz(
+			canvas.SVG,
+			util.GetBlockSize(),
+			util.GetMarginSize(),
+		)
+		configureBufferViz(&b)
+		return &b, canvas.End
+	case "png":
+		canvas := render.NewCanvasPng(output)
+		// Cells are squares of a few pixels, the SVG block size would
+		// need gigabytes at the cell limit
+		cellSize := viper.GetInt("png-cell-size")
+		iv := bufferviz.NewImageViz(
+			canvas,
+			model.Size{Width: cellSize, Height: cellSize},
+			util.GetMarginSize(),
+		)
+		configureBufferViz(&iv.BufferViz)
+		// Raster images handle far more cells than SVG
+		iv.MaxCells = viper.GetInt("png-max-cells")
+		return &iv, canvas.End
+	}
+	logrus.Fatalf("Unknown output format '%s'", format)
+	return nil, nil
+}
+
 func generateFun(cmd *cobra.Command, args []string) {
 	dbConfig := db.GetDbConfigCli()
 
 	timeout := viper.GetDuration("timeout")
-	output := viper.GetString("output")
+	format := viper.GetString("format")
+	output := getOutput(format)
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	d, err := db.NewDbPool(ctx, dbConfig.ConnectUrl)
+	if err != nil {
+		logrus.Fatalf("Error connecting to PostgreSQL: %s", eris.ToString(err, true))
+	}
+	d.FetchOptions = dbConfig.FetchOptions
+	d.UserQueryTimeout = dbConfig.UserQueryTimeout
+	table, err := d.FetchTable(ctx, dbConfig.Relation)
+	if err != nil {
+		logrus.Fatalf("Error when fetching table information: %s", eris.ToString(err, true))
+	}
+	highlightQuery := viper.GetString("highlight-query")
+	if highlightQuery != "" {
+		err = d.HighlightQueryRows(ctx, &table, highlightQuery)
+		if err != nil {
+			logrus.Fatalf("Error when locating rows: %s", eris.ToString(err, true))
+		}
+	}
+	traceQuery := viper.GetString("trace-query")
+	if traceQuery != "" {
+		err = d.TraceQuery(ctx, &table, traceQuery)
+		if err != nil {
+			logrus.Fatalf("Error when tracing query: %s", eris.ToString(err, true))
+		}
+	}
+	lookupIndex := viper.GetString("lookup-index")
+	if lookupIndex != "" {
+		err = d.TraceKeyLookup(ctx, &table, lookupIndex, viper.GetString("lookup-key"))
+		if err != nil {
+			logrus.Fatalf("Error when tracing key lookup: %s", eris.ToString(err, true))
+		}
+	}
+	brinIndex := viper.GetString("brin-index")
+	if brinIndex != "" && table.GetBrin(brinIndex) == nil {
+		logrus.Fatalf("No BRIN ranges fetched for index '%s'", brinIndex)
+	}
+	insertTupleSize := viper.GetInt("insert-tuple-size")
+	if insertTupleSize > 0 {
+		simulation, err := d.HighlightInserts(ctx, &table, insertTupleSize, viper.GetInt("insert-fillfactor"))
+		if err != nil {
+			logrus.Fatalf("Error when simulating inserts: %s", eris.ToString(err, true))
+		}
+		logrus.Infof("%s: %d", simulation.GetLabel(), simulation.InsertsBeforeExtend)
+	}
+
+	renderer, end := newRenderer(format, output)
+	renderer.DrawTable(table)
+	renderer.AddFooter()
+	end()
+
+	os.Exit(0)
+}
+
+func correlationFun(cmd *cobra.Command, args []string) {
+	dbConfig := db.GetDbConfigCli()
+
+	timeout := viper.GetDuration("timeout")
+	output := getOutput("svg")
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	d, err := db.NewDbPool(ctx, dbConfig.ConnectUrl)
+	if err != nil {
+		logrus.Fatalf("Error connecting to PostgreSQL: %s", eris.ToString(err, true))
+	}
+	d.FetchOptions = dbConfig.FetchOptions
+	table, err := d.FetchTable(ctx, dbConfig.Relation)
+	if err != nil {
+		logrus.Fatalf("Error when fetching table information: %s", eris.ToString(err, true))
+	}
+	correlations, err := d.FetchCorrelations(ctx, table)
+	if err != nil {
+		logrus.Fatalf("Error when fetching index correlations: %s", eris.ToString(err, true))
+	}
+	for _, correlation := range correlations {
+		fmt.Printf("%s: clustering factor %d, %d items, %d heap blocks, clustering ratio %.2f\n",
+			correlation.Index, correlation.ClusteringFactor, len(correlation.HeapBlocks),
+			correlation.NumHeapBlocks, correlation.GetClusteringRatio())
+	}
+
+	canvas := render.NewCanvasFile(output)
+	bufferviz.DrawCorrelations(canvas.SVG, table, correlations)
+	canvas.End()
+
+	os.Exit(0)
+}
+
+func btreeFun(cmd *cobra.Command, args []string) {
+	dbConfig := db.GetDbConfigCli()
+
+	timeout := viper.GetDuration("timeout")
+	output := getOutput("svg")
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	d, err := db.NewDbPool(ctx, dbConfig.ConnectUrl)
+	if err != nil {
+		logrus.Fatalf("Error connecting to PostgreSQL: %s", eris.ToString(err, true))
+	}
+	d.FetchOptions = dbConfig.FetchOptions
+	table, err := d.FetchTable(ctx, dbConfig.Relation)
+	if err != nil {
+		logrus.Fatalf("Error when fetching table information: %s", eris.ToString(err, true))
+	}
+	trees, err := d.FetchBtreeTrees(ctx, table)
+	if err != nil {
+		logrus.Fatalf("Error when fetching btree structures: %s", eris.ToString(err, true))
+	}
+	for _, tree := range trees {
+		fmt.Printf("%s: height %d, fan-out %.1f\n", tree.Index, len(tree.Levels), tree.GetFanout())
+		for i, nodes := range tree.Levels {
+			fmt.Printf("  level %d: %d pages, %d items\n", tree.Meta.Level-i, len(nodes), tree.GetNumItems(i))
+		}
+	}
+
+	canvas := render.NewCanvasFile(output)
+	bufferviz.DrawBtreeTrees(canvas.SVG, table, trees)
+	canvas.End()
+
+	os.Exit(0)
+}
+
+func bloatFun(cmd *cobra.Command, args []string) {
+	dbConfig := db.GetDbConfigCli()
+
+	timeout := viper.GetDuration("timeout")
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	d, err := db.NewDbPool(ctx, dbConfig.ConnectUrl)
+	if err != nil {
+		logrus.Fatalf("Error connecting to PostgreSQL: %s", eris.ToString(err, true))
+	}
+	d.FetchOptions = dbConfig.FetchOptions
+	table, err := d.FetchTable(ctx, dbConfig.Relation)
+	if err != nil {
+		logrus.Fatalf("Error when fetching table information: %s", eris.ToString(err, true))
+	}
+	var total int64
+	for _, bloat := range table.GetBloat() {
+		fmt.Printf("%s: %s\n", bloat.Relation, bloat.String())
+		total += bloat.GetReclaimable()
+	}
+	fmt.Printf("Total reclaimable: %s\n", model.FormatSize(total))
+
+	os.Exit(0)
+}
+
+func recommendFun(cmd *cobra.Command, args []string) {
+	dbConfig := db.GetDbConfigCli()
+
+	timeout := viper.GetDuration("timeout")
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	d, err := db.NewDbPool(ctx, dbConfig.ConnectUrl)
+	if err != nil {
+		logrus.Fatalf("Error connecting to PostgreSQL: %s", eris.ToString(err, true))
+	}
+	d.FetchOptions = dbConfig.FetchOptions
+	// Evidence comes from the tuples, visibility map, index pages and
+	// statistics, skipped when their extension is missing
+	d.Tuples = true
+	d.Visibility = true
+	d.IndexPages = true
+	d.Stats = true
+	table, err := d.FetchTable(ctx, dbConfig.Relation)
+	if err != nil {
+		logrus.Fatalf("Error when fetching table information: %s", eris.ToString(err, true))
+	}
+	for _, missing := range table.GetMissingEvidence() {
+		fmt.Printf("Unavailable evidence for %s\n", missing)
+	}
+	recommendations := table.GetRecommendations()
+	if len(recommendations) == 0 {
+		fmt.Printf("%s: no maintenance needed\n", table.Name)
+	}
+	for i, r := range recommendations {
+		fmt.Printf("%d. %s on %s (score %.2f)\n", i+1, r.Action, r.Relation, r.Score)
+		for _, evidence := range r.Evidence {
+			fmt.Printf("   - %s\n", evidence)
+		}
+		fmt.Printf("   %s\n", r.Command)
+	}
+
+	os.Exit(0)
+}
+
+func fillfactorFun(cmd *cobra.Command, args []string) {
+	dbConfig := db.GetDbConfigCli()
+
+	timeout := viper.GetDuration("timeout")
+	output := getOutput("svg")
 	ctx := context.Background()
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
@@ -51,24 +309,60 @@ func generateFun(cmd *cobra.Command, args []string) {
 	if err != nil {
 		logrus.Fatalf("Error connecting to PostgreSQL: %s", eris.ToString(err, true))
 	}
+	d.FetchOptions = dbConfig.FetchOptions
 	table, err := d.FetchTable(ctx, dbConfig.Relation)
 	if err != nil {
 		logrus.Fatalf("Error when fetching table information: %s", eris.ToString(err, true))
 	}
+	simulation, err := d.SimulateFillfactor(ctx, &table, viper.GetInt("fillfactor"))
+	if err != nil {
+		logrus.Fatalf("Error when simulating fillfactor: %s", eris.ToString(err, true))
+	}
+	for _, line := range simulation.GetSummary() {
+		fmt.Println(line)
+	}
 
 	canvas := render.NewCanvasFile(output)
-	b := bufferviz.NewBufferViz(
-		canvas.SVG,
-		util.GetBlockSize(),
-		util.GetMarginSize(),
-	)
-	b.DrawTable(table)
+	b := bufferviz.NewBufferViz(canvas.SVG, util.GetBlockSize(), util.GetMarginSize())
+	configureBufferViz(&b)
+	b.DrawFillfactorSimulation(simulation)
 	b.AddFooter()
 	canvas.End()
 
 	os.Exit(0)
 }
 
+func dumpPageFun(cmd *cobra.Command, args []string) {
+	dbConfig := db.GetDbConfigCli()
+
+	timeout := viper.GetDuration("timeout")
+	block := viper.GetInt("block")
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	d, err := db.NewDbPool(ctx, dbConfig.ConnectUrl)
+	if err != nil {
+		logrus.Fatalf("Error connecting to PostgreSQL: %s", eris.ToString(err, true))
+	}
+	raw, err := d.FetchRawPage(ctx, dbConfig.Relation, block)
+	if err != nil {
+		logrus.Fatalf("Error when fetching page: %s", eris.ToString(err, true))
+	}
+	isHeap, err := d.IsHeap(ctx, dbConfig.Relation)
+	if err != nil {
+		logrus.Fatalf("Error when fetching relation kind: %s", eris.ToString(err, true))
+	}
+	ranges, err := page.Decode(raw, isHeap)
+	if err != nil {
+		logrus.Fatalf("Error when decoding page: %s", eris.ToString(err, true))
+	}
+	err = page.WriteHexDump(os.Stdout, raw, ranges, viper.GetBool("color"))
+	util.FatalIf(err)
+
+	os.Exit(0)
+}
+
 func handleSignals(cancel context.CancelFunc) {
 	sigIn := make(chan os.Signal, 100)
 	signal.Notify(sigIn)
@@ -125,17 +419,80 @@ func main() {
 		Run:   serveFun,
 		Short: "Start the http server",
 	}
+	dumpPage := &cobra.Command{
+		Use:   "dump-page",
+		Run:   dumpPageFun,
+		Short: "Print an annotated hex dump of a block",
+	}
+	correlation := &cobra.Command{
+		Use:   "correlation",
+		Run:   correlationFun,
+		Short: "Plot the heap blocks referenced by btree indexes in key order",
+	}
+	btree := &cobra.Command{
+		Use:   "btree",
+		Run:   btreeFun,
+		Short: "Draw the structure of btree indexes from the root to the leaves",
+	}
+	bloat := &cobra.Command{
+		Use:   "bloat",
+		Run:   bloatFun,
+		Short: "Estimate the space reclaimable in the heap, indexes and toast",
+	}
+	recommend := &cobra.Command{
+		Use:   "recommend",
+		Run:   recommendFun,
+		Short: "Print ranked maintenance recommendations with their evidence",
+	}
+	fillfactor := &cobra.Command{
+		Use:   "fillfactor",
+		Run:   fillfactorFun,
+		Short: "Draw the heap next to its predicted layout after a rewrite with another fillfactor",
+	}
 	rootCmd.AddCommand(generate)
+	rootCmd.AddCommand(bloat)
+	rootCmd.AddCommand(recommend)
+	rootCmd.AddCommand(fillfactor)
+	rootCmd.AddCommand(correlation)
+	rootCmd.AddCommand(btree)
 	rootCmd.AddCommand(serve)
+	rootCmd.AddCommand(dumpPage)
 
 	// Setup Flags
 	rootFlags := rootCmd.PersistentFlags()
 	util.SetCommonCliFlags(rootFlags, "info")
 	db.SetDbConfigFlags(rootFlags)
-	rootFlags.String("output", "output.svg", "Output filename")
+	rootFlags.String("output", "", "Output filename, output.svg or output.png depending on the format by default")
 	err := viper.BindPFlags(rootFlags)
 	util.FatalIf(err)
 
+	generateFlags := generate.Flags()
+	generateFlags.String("format", "svg", "Output format: svg or png")
+	generateFlags.Int("png-cell-size", 1, "Width and height in pixels of a cell in png format")
+	generateFlags.Int("png-max-cells", 16000000, "Maximum number of cells to draw in png format, consecutive blocks are aggregated above it. 0 disables aggregation")
+	generateFlags.String("highlight-query", "", "Read only query returning ctids of the rows to highlight")
+	generateFlags.String("trace-query", "", "Read only query to run, blocks it loads in shared buffers are highlighted")
+	generateFlags.String("lookup-index", "", "Btree index to trace a key lookup in, visited pages and matching heap blocks are highlighted")
+	generateFlags.String("lookup-key", "", "Key value looked up in the lookup index, compared with the index's first column")
+	generateFlags.Int("insert-tuple-size", 0, "Size of tuples to simulate inserts with, blocks receiving them before the heap extends are highlighted. 0 disables the simulation")
+	generateFlags.Int("insert-fillfactor", 0, "Fillfactor of the heap used by the insert simulation. 0 uses the table's fillfactor")
+	generateFlags.String("brin-index", "", "BRIN index whose ranges are drawn, the first BRIN index by default")
+	generateFlags.Bool("show-bloat", false, "Draw a panel with the estimated reclaimable space")
+	generateFlags.Bool("show-recommendations", false, "Draw a panel with the ranked maintenance recommendations")
+	err = viper.BindPFlags(generateFlags)
+	util.FatalIf(err)
+
+	fillfactorFlags := fillfactor.Flags()
+	fillfactorFlags.Int("fillfactor", 90, "Fillfactor of the simulated rewrite, between 10 and 100")
+	err = viper.BindPFlags(fillfactorFlags)
+	util.FatalIf(err)
+
+	dumpPageFlags := dumpPage.Flags()
+	dumpPageFlags.Int("block", 0, "Block number to dump")
+	dumpPageFlags.Bool("color", true, "Color byte ranges")
+	err = viper.BindPFlags(dumpPageFlags)
+	util.FatalIf(err)
+
 	serveFlags := serve.Flags()
 	httpserver.SetHttpServerConfigFlags(serveFlags)
 	err = viper.BindPFlags(serveFlags)
@@ -0,0 +1,215 @@
+package bufferviz
+
+import (
+	"fmt"
+	"math"
+
+	svg "github.com/ajstarks/svgo"
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/bonnefoa/pg_buffer_viz/pkg/render"
+)
+
+const (
+	treeWidth        = 1200
+	treeLabelWidth   = 120
+	treeNodeHeight   = 18
+	treeLevelSpacing = 60
+	// Levels with more pages are drawn as groups of consecutive pages
+	treeMaxNodes = 1000
+	// Downlinks and sibling links are only drawn below this number of pages
+	treeMaxLinkedNodes = 300
+)
+
+const treeCss = `
+text { font-family:"Verdana"; font-size:11px; }
+.tree-title { font-size:13px; font-weight:bold; }
+.tree-label { font-size:10px; fill:rgb(80, 80, 80); }
+.tree-node { stroke:rgb(60, 60, 60); stroke-width:0.5; }
+.tree-node:hover { stroke:black; stroke-width:1.5; }
+.tree-meta { fill:rgb(220, 220, 240); stroke:rgb(60, 60, 60); stroke-width:0.5; }
+.tree-downlink { stroke:rgb(120, 120, 120); stroke-width:0.5; }
+.tree-sibling { fill:none; stroke:rgb(30, 60, 160); stroke-width:0.7; }
+.tree-sibling-broken { fill:none; stroke:rgb(200, 0, 0); stroke-width:1.5; }
+`
+
+// treeBox is the horizontal extent of a node, or of a group of consecutive
+// nodes, of a level
+type treeBox struct {
+	x     int
+	width int
+	nodes []model.BtreeNode
+}
+
+func (t *treeBox) center() int {
+	return t.x + t.width/2
+}
+
+// getTreeBoxes splits a level's width between its pages proportionally to
+// their item count, grouping consecutive pages above treeMaxNodes
+func getTreeBoxes(nodes []model.BtreeNode) []treeBox {
+	nodesPerBox := int(math.Ceil(float64(len(nodes)) / treeMaxNodes))
+	weights := make([]int, 0)
+	totalWeight := 0
+	for start := 0; start < len(nodes); start += nodesPerBox {
+		weight := 0
+		for _, node := range nodes[start:min(start+nodesPerBox, len(nodes))] {
+			// Empty pages still get a visible node
+			weight += max(node.LiveItems, 1)
+		}
+		weights = append(weights, weight)
+		totalWeight += weight
+	}
+	boxes := make([]treeBox, 0, len(weights))
+	cumulated := 0
+	for i, weight := range weights {
+		start := i * nodesPerBox
+		x := cumulated * treeWidth / totalWeight
+		cumulated += weight
+		boxes = append(boxes, treeBox{
+			x:     x,
+			width: max(1, cumulated*treeWidth/totalWeight-x),
+			nodes: nodes[start:min(start+nodesPerBox, len(nodes))],
+		})
+	}
+	return boxes
+}
+
+func getTreeBoxTitle(box treeBox) string {
+	if len(box.nodes) == 1 {
+		node := box.nodes[0]
+		return fmt.Sprintf("Block %d (type %s): %d live items, %d dead, %d bytes free, fill %.0f%%, prev %d, next %d",
+			node.Block, node.Type, node.LiveItems, node.DeadItems, node.FreeSize,
+			100*node.GetFill(), node.Prev, node.Next)
+	}
+	liveItems, deadItems := 0, 0
+	fill := 0.0
+	for _, node := range box.nodes {
+		liveItems += node.LiveItems
+		deadItems += node.DeadItems
+		fill += node.GetFill()
+	}
+	return fmt.Sprintf("%d pages from block %d to %d: %d live items, %d dead, average fill %.0f%%",
+		len(box.nodes), box.nodes[0].Block, box.nodes[len(box.nodes)-1].Block,
+		liveItems, deadItems, 100*fill/float64(len(box.nodes)))
+}
+
+// getTreeBoxFill returns the node color, using the FSM colors of the
+// average free space of the box's pages
+func getTreeBoxFill(box treeBox) string {
+	freeSize := 0
+	for _, node := range box.nodes {
+		freeSize += node.FreeSize
+	}
+	fsmBucket := min(255, freeSize/len(box.nodes)/32)
+	color := render.FsmColor(fsmBucket)
+	return fmt.Sprintf("fill:rgb(%d,%d,%d)", color.R, color.G, color.B)
+}
+
+func getTreePanelHeight(tree model.BtreeTree) int {
+	return 2*treeLevelSpacing + len(tree.Levels)*treeLevelSpacing
+}
+
+func drawTreeLevel(canvas *svg.SVG, x int, y int, level int, nodes []model.BtreeNode, boxes []treeBox) {
+	numItems := 0
+	for _, node := range nodes {
+		numItems += node.LiveItems
+	}
+	canvas.Text(x-treeLabelWidth, y+treeNodeHeight/2, fmt.Sprintf("level %d", level), "class=\"tree-label\"")
+	canvas.Text(x-treeLabelWidth, y+treeNodeHeight/2+12,
+		fmt.Sprintf("%d pages, %d items", len(nodes), numItems), "class=\"tree-label\"")
+	for _, box := range boxes {
+		canvas.Group()
+		canvas.Title(getTreeBoxTitle(box))
+		canvas.Rect(x+box.x, y, box.width, treeNodeHeight, "class=\"tree-node\"", getTreeBoxFill(box))
+		canvas.Gend()
+	}
+	if len(nodes) > treeMaxLinkedNodes {
+		return
+	}
+	// Sibling links, in red when the left link of the next page doesn't
+	// point back
+	for i := 0; i+1 < len(boxes); i++ {
+		class := "tree-sibling"
+		if boxes[i+1].nodes[0].Prev != boxes[i].nodes[0].Block {
+			class = "tree-sibling-broken"
+		}
+		x1, x2 := x+boxes[i].center(), x+boxes[i+1].center()
+		canvas.Path(fmt.Sprintf("M %d %d Q %d %d %d %d", x1, y, (x1+x2)/2, y-8, x2, y), fmt.Sprintf("class=\"%s\"", class))
+	}
+}
+
+// drawDownlinks draws a line from each internal page to its children
+func drawDownlinks(canvas *svg.SVG, x int, y int, parents []treeBox, children []treeBox) {
+	childCenters := make(map[int]int)
+	for _, child := range children {
+		childCenters[child.nodes[0].Block] = child.center()
+	}
+	for _, parent := range parents {
+		for _, childBlock := range parent.nodes[0].Children {
+			childCenter, ok := childCenters[childBlock]
+			if !ok {
+				continue
+			}
+			canvas.Line(x+parent.center(), y+treeNodeHeight, x+childCenter, y+treeLevelSpacing, "class=\"tree-downlink\"")
+		}
+	}
+}
+
+func drawTreePanel(canvas *svg.SVG, y int, tree model.BtreeTree) {
+	x := treeLabelWidth
+	numPages := 0
+	for _, nodes := range tree.Levels {
+		numPages += len(nodes)
+	}
+	leafFill := 0.0
+	if len(tree.Levels) > 0 {
+		leaves := tree.Levels[len(tree.Levels)-1]
+		for _, leaf := range leaves {
+			leafFill += leaf.GetFill()
+		}
+		leafFill /= float64(max(1, len(leaves)))
+	}
+	canvas.Text(20, y+20, fmt.Sprintf("%s: height %d, %d pages, fan-out %.1f, average leaf fill %.0f%%",
+		tree.Index, len(tree.Levels), numPages, tree.GetFanout(), 100*leafFill), "class=\"tree-title\"")
+
+	// Metapage
+	y += treeLevelSpacing / 2
+	meta := fmt.Sprintf("metapage: root %d at level %d", tree.Meta.Root, tree.Meta.Level)
+	if tree.Meta.FastRoot != tree.Meta.Root {
+		meta += fmt.Sprintf(", fast root %d at level %d", tree.Meta.FastRoot, tree.Meta.FastLevel)
+	}
+	canvas.Rect(x, y, 340, treeNodeHeight, "class=\"tree-meta\"")
+	canvas.Text(x+6, y+treeNodeHeight-5, meta)
+	y += treeLevelSpacing
+
+	var parents []treeBox
+	for i, nodes := range tree.Levels {
+		boxes := getTreeBoxes(nodes)
+		if parents != nil && len(nodes) <= treeMaxLinkedNodes {
+			drawDownlinks(canvas, x, y-treeLevelSpacing, parents, boxes)
+		}
+		drawTreeLevel(canvas, x, y, tree.Meta.Level-i, nodes, boxes)
+		parents = boxes
+		y += treeLevelSpacing
+	}
+}
+
+// DrawBtreeTrees draws the structure of btree indexes, from the metapage
+// to the leaves. Nodes' widths are proportional to their number of items
+// and their color follows their free space.
+func DrawBtreeTrees(canvas *svg.SVG, table model.Table, trees []model.BtreeTree) {
+	height := 2 * treeLevelSpacing
+	for _, tree := range trees {
+		height += getTreePanelHeight(tree)
+	}
+	canvas.Start(treeLabelWidth+treeWidth+20, height)
+	canvas.Style("text/css", treeCss)
+	if len(trees) == 0 {
+		canvas.Text(20, 30, fmt.Sprintf("No btree index on %s", table.Name), "class=\"tree-title\"")
+	}
+	y := 0
+	for _, tree := range trees {
+		drawTreePanel(canvas, y, tree)
+		y += getTreePanelHeight(tree)
+	}
+}
@@ -2,20 +2,51 @@ package bufferviz
 
 import (
 	"fmt"
+	"html"
+	"strings"
 
 	svg "github.com/ajstarks/svgo"
+	"github.com/bonnefoa/pg_buffer_viz/pkg/layout"
 	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
 	"github.com/bonnefoa/pg_buffer_viz/pkg/render"
 	"github.com/sirupsen/logrus"
 )
 
+// Renderer draws a table in an output format
+type Renderer interface {
+	DrawTable(table model.Table)
+	AddFooter()
+}
+
 type BufferViz struct {
 	canvas *svg.SVG
 
 	BlockSize  model.Size
 	MarginSize model.Size
+	// Maximum number of cells to draw, blocks are aggregated above it.
+	// 0 disables aggregation.
+	MaxCells int
+	Layout   layout.Layout
+	// Layer used to color cells, described in the legend. No legend is
+	// drawn when nil.
+	Layer *Layer
+	// BRIN index whose ranges are drawn as alternating bands, the first
+	// one when empty
+	BrinIndex string
+	// Whether the estimated reclaimable space and the maintenance
+	// recommendations are drawn in panels
+	ShowBloat           bool
+	ShowRecommendations bool
 
 	currentCoordinate model.Coordinate
+	blocksPerCell     int
+	// Whether texts like the legend and controls are drawn
+	drawTexts bool
+	// Legend entries specific to the drawn table
+	tableLegend    []LegendEntry
+	highlightLabel string
+	// Text panels specific to the drawn table
+	panels []Panel
 }
 
 func NewBufferViz(canvas *svg.SVG, blockSize model.Size, marginSize model.Size) BufferViz {
@@ -24,6 +55,10 @@ func NewBufferViz(canvas *svg.SVG, blockSize model.Size, marginSize model.Size)
 		BlockSize:         blockSize,
 		MarginSize:        marginSize,
 		currentCoordinate: model.Coordinate{X: 1, Y: 1},
+		blocksPerCell:     1,
+		Layout:            layout.RowMajor{},
+		Layer:             &FsmLayer,
+		drawTexts:         true,
 	}
 	return b
 }
@@ -48,76 +83,254 @@ func (b *BufferViz) drawName(relation model.Relation) {
 	b.canvas.Text(xPos, int(yPos), relation.Name, "text-align:left;font-size:10px")
 }
 
+func (b *BufferViz) getCellClasses(relation model.Relation, cell model.Cell) string {
+	classes := []string{"block", fmt.Sprintf("fsm%d", cell.AvgFree/32)}
+	// Indexes with page types are colored by type, their FSM only tracks
+	// recyclable pages
+	if cell.PageType != "" {
+		classes[1] = getPageTypeClass(cell.PageType)
+		if hasIncompleteSplit(relation, cell) {
+			classes = append(classes, "page-follow-right")
+		}
+	}
+	if cell.Highlight > 0 {
+		classes = append(classes, "highlighted")
+	}
+	if cell.Truncatable {
+		classes = append(classes, "truncatable")
+	}
+	if brin := b.getDrawnBrin(relation); brin != nil {
+		if brinRange := brin.GetRange(cell.StartBlock); brinRange != nil {
+			if (brinRange.Start/brin.PagesPerRange)%2 == 1 {
+				classes = append(classes, "brin-odd")
+			}
+			if !brinRange.Summarized {
+				classes = append(classes, "brin-unsummarized")
+			}
+		}
+		if brin.GetNumRanges(cell.StartBlock, cell.GetEndBlock()) > 1 {
+			classes = append(classes, "brin-boundary")
+		}
+	}
+	return strings.Join(classes, " ")
+}
+
+func (b *BufferViz) getCellAttributes(relation model.Relation, cell model.Cell) []string {
+	attributes := []string{
+		fmt.Sprintf("id=\"%s_%d\"", html.EscapeString(relation.Name), cell.StartBlock),
+		fmt.Sprintf("class=\"%s\"", b.getCellClasses(relation, cell)),
+		fmt.Sprintf("data-start=\"%d\" data-end=\"%d\"", cell.StartBlock, cell.GetEndBlock()),
+		fmt.Sprintf("data-min=\"%d\" data-avg=\"%d\" data-max=\"%d\"", cell.MinFree, cell.AvgFree, cell.MaxFree),
+		fmt.Sprintf("data-full=\"%d\" data-empty=\"%d\"", cell.NumFull, cell.NumEmpty),
+	}
+	if relation.Cached != nil {
+		attributes = append(attributes, fmt.Sprintf("data-cached=\"%d\"", cell.NumCached))
+	}
+	if relation.AllVisible != nil {
+		attributes = append(attributes, fmt.Sprintf("data-visible=\"%d\" data-frozen=\"%d\"",
+			cell.NumAllVisible, cell.NumAllFrozen))
+	}
+	if cell.Highlight > 0 {
+		attributes = append(attributes, fmt.Sprintf("data-highlight=\"%d\"", cell.Highlight))
+	}
+	if cell.Truncatable {
+		attributes = append(attributes, "data-truncatable=\"1\"")
+	}
+	if relation.Tuples != nil {
+		attributes = append(attributes, fmt.Sprintf("data-live=\"%d\" data-dead=\"%d\" data-bytes=\"%d\"",
+			cell.Tuples.Live, cell.Tuples.Dead, cell.Tuples.LiveBytes))
+	}
+	if len(relation.Brin) > 0 {
+		attributes = append(attributes, getBrinAttributes(relation.Brin, b.getDrawnBrin(relation), cell)...)
+	}
+	if relation.IndexPages != nil {
+		attributes = append(attributes, getIndexPageAttributes(relation, cell)...)
+	}
+	if len(cell.References) > 0 {
+		attributes = append(attributes, fmt.Sprintf("data-refs=\"%s\"", formatBlockRanges(cell.References)))
+	}
+	return attributes
+}
+
+// getDrawnBrin returns the summary of the BRIN index drawn over the
+// relation, nil when it has none
+func (b *BufferViz) getDrawnBrin(relation model.Relation) *model.BrinSummary {
+	if b.BrinIndex != "" {
+		return relation.GetBrin(b.BrinIndex)
+	}
+	if len(relation.Brin) > 0 {
+		return &relation.Brin[0]
+	}
+	return nil
+}
+
+// getBrinAttributes returns the summary of the BRIN ranges holding the
+// cell's first block, one line per index separated by "|". The overlaps are
+// the drawn index's.
+func getBrinAttributes(summaries []model.BrinSummary, drawn *model.BrinSummary, cell model.Cell) []string {
+	lines := make([]string, 0)
+	for _, brin := range summaries {
+		brinRange := brin.GetRange(cell.StartBlock)
+		if brinRange == nil {
+			continue
+		}
+		line := fmt.Sprintf("%s: blocks %d-%d ", brin.Index, brinRange.Start, brinRange.GetEnd(brin.PagesPerRange))
+		if !brinRange.Summarized {
+			line += "unsummarized"
+		} else {
+			line += brinRange.Value
+			if brinRange.Overlaps >= 0 {
+				line += fmt.Sprintf(", overlaps %d ranges", brinRange.Overlaps)
+			}
+		}
+		if numRanges := brin.GetNumRanges(cell.StartBlock, cell.GetEndBlock()); numRanges > 1 {
+			line += fmt.Sprintf(", cell spans %d ranges", numRanges)
+		}
+		lines = append(lines, line)
+	}
+	attributes := []string{fmt.Sprintf("data-brin=\"%s\"", html.EscapeString(strings.Join(lines, "|")))}
+	if drawn == nil {
+		return attributes
+	}
+	if brinRange := drawn.GetRange(cell.StartBlock); brinRange != nil && brinRange.Overlaps >= 0 {
+		attributes = append(attributes, fmt.Sprintf("data-brin-overlaps=\"%d\"", brinRange.Overlaps))
+	}
+	return attributes
+}
+
+// formatBlockRanges compacts sorted blocks in ranges, like "1-4,7"
+func formatBlockRanges(blocks []int) string {
+	ranges := make([]string, 0)
+	for i := 0; i < len(blocks); {
+		end := i
+		for end+1 < len(blocks) && blocks[end+1] == blocks[end]+1 {
+			end++
+		}
+		if end == i {
+			ranges = append(ranges, fmt.Sprintf("%d", blocks[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", blocks[i], blocks[end]))
+		}
+		i = end + 1
+	}
+	return strings.Join(ranges, ",")
+}
+
+func (b *BufferViz) drawAnnotations(origin model.Coordinate, annotator layout.Annotator, relation model.Relation) {
+	labels, lines := annotator.Annotations(relation)
+	for _, line := range lines {
+		x1, y1 := b.coordinateToPosition(model.Coordinate{X: origin.X + line.From.X, Y: origin.Y + line.From.Y})
+		x2, y2 := b.coordinateToPosition(model.Coordinate{X: origin.X + line.To.X, Y: origin.Y + line.To.Y})
+		b.canvas.Line(x1+1, y1+1, x2+1, y2+1, fmt.Sprintf("class=\"%s\"", line.Class))
+	}
+	for _, label := range labels {
+		// Text is drawn on the baseline, at the bottom of the cell
+		x, y := b.coordinateToPosition(model.Coordinate{X: origin.X + label.X, Y: origin.Y + label.Y + 1})
+		b.canvas.Text(x, y, label.Text, fmt.Sprintf("class=\"%s\"", label.Class))
+	}
+}
+
 func (b *BufferViz) drawRelation(relation model.Relation) model.Size {
-	relationSize := relation.GetRelationSize()
-	numBuffers := relation.GetNumbBuffers()
+	cells := relation.GetCells(b.blocksPerCell)
+	grid := b.Layout.GetGrid(len(cells), b.blocksPerCell)
+	relationSize := grid.Size()
 
 	b.drawName(relation)
+	groupAttributes := []string{
+		"class=\"relation\"",
+		fmt.Sprintf("data-relation=\"%s\"", html.EscapeString(relation.Name)),
+		fmt.Sprintf("data-filepath=\"%s\"", html.EscapeString(relation.Filepath)),
+		fmt.Sprintf("data-highlight-label=\"%s\"", html.EscapeString(b.highlightLabel)),
+	}
+	if relation.Heap != "" {
+		groupAttributes = append(groupAttributes, fmt.Sprintf("data-heap=\"%s\"", html.EscapeString(relation.Heap)))
+	}
+	if relation.Summary != "" {
+		groupAttributes = append(groupAttributes, fmt.Sprintf("data-summary=\"%s\"", html.EscapeString(relation.Summary)))
+	}
+	b.canvas.Group(groupAttributes...)
 
 	coordinate := b.currentCoordinate
 	coordinate.Y += 1
 
-	// Draw one rect per block
-	for line := range relationSize.Width {
-		for column := range relationSize.Width {
-			bufno := line*relationSize.Width + column
-			if bufno >= numBuffers {
-				break
-			}
-			x := (coordinate.X + column) * b.BlockSize.Width
-			y := (coordinate.Y + line) * b.BlockSize.Height
-			fsmBucket := relation.Fsm[bufno] / 32
-			blockId := fmt.Sprintf("id=\"%s_%d\"", relation.Name, bufno)
-
-			b.canvas.Rect(x+2, y+2, b.BlockSize.Width-1, b.BlockSize.Height-1, blockId,
-				fmt.Sprintf("class=\"block fsm%d\"", fsmBucket))
-		}
+	// Draw one rect per cell
+	for i, cell := range cells {
+		position := grid.Position(i)
+		x := (coordinate.X + position.X) * b.BlockSize.Width
+		y := (coordinate.Y + position.Y) * b.BlockSize.Height
+		b.canvas.Rect(x+2, y+2, b.BlockSize.Width-1, b.BlockSize.Height-1,
+			b.getCellAttributes(relation, cell)...)
+	}
+	b.canvas.Gend()
+	b.drawPageLinks(coordinate, grid, relation)
+	if annotator, ok := grid.(layout.Annotator); ok {
+		b.drawAnnotations(coordinate, annotator, relation)
 	}
 	relationSize.Add(b.MarginSize)
 
 	return relationSize
 }
 
-func (b *BufferViz) DrawTable(table model.Table) {
-	drawSize := b.getDrawSize(table)
-	width := drawSize.Width * b.BlockSize.Width
-	height := drawSize.Height * b.BlockSize.Height
+// setupCells computes the number of blocks aggregated in a cell to draw
+// numBlocks blocks
+func (b *BufferViz) setupCells(numBlocks int) {
+	b.blocksPerCell = model.GetBlocksPerCell(numBlocks, b.MaxCells)
+	if b.blocksPerCell > 1 {
+		logrus.Infof("Aggregating %d blocks per cell", b.blocksPerCell)
+	}
+}
 
-	render.StartSVG(b.canvas, width, height)
+// setupTable computes the aggregation level and returns the size in pixels
+// of the table's drawing
+func (b *BufferViz) setupTable(table model.Table) (width, height int) {
+	b.setupCells(table.GetNumBuffers())
+	b.tableLegend = b.getTableLegend(table)
+	b.panels = b.getTablePanels(table)
+	b.highlightLabel = table.HighlightLabel
+	drawSize := b.getDrawSize(table)
+	return drawSize.Width * b.BlockSize.Width, drawSize.Height * b.BlockSize.Height
+}
 
-	// Track height to know the position for the relation
+// walkRow places relations side by side and moves below them
+func (b *BufferViz) walkRow(relations []model.Relation, drawRelation func(model.Relation) model.Size) {
+	// Track height to know the position of the next row
 	totalSize := model.Size{Width: 0, Height: 0}
 	initialPos := b.currentCoordinate
 
-	for _, index := range table.Indexes {
-		logrus.Infof("Drawing index %s", index.Name)
-		relationSize := b.drawRelation(index)
-
+	for _, relation := range relations {
+		logrus.Infof("Drawing relation %s at coord %v", relation.Name, b.currentCoordinate)
+		relationSize := drawRelation(relation)
 		b.currentCoordinate.X += relationSize.Width
 		totalSize.AddWidthMaxHeight(relationSize)
 	}
 
-	if table.Toast != nil {
-		toast := table.Toast
-		logrus.Infof("Drawing toast %s", toast.Name)
-		toastSize := b.drawRelation(toast.Relation)
-		b.currentCoordinate.X += toastSize.Width
-		totalSize.AddWidthMaxHeight(toastSize)
-
-		logrus.Infof("Drawing toast index %s at coord %v", toast.Index.Name, b.currentCoordinate)
-		toastIndexSize := b.drawRelation(toast.Index)
-		b.currentCoordinate.X += toastIndexSize.Width
-		totalSize.AddWidthMaxHeight(toastIndexSize)
-	}
-
 	b.currentCoordinate = initialPos
 	b.currentCoordinate.AddHeight(totalSize)
+}
+
+// walkTable places the table's relations, indexes and toast first with the
+// table below them
+func (b *BufferViz) walkTable(table model.Table, drawRelation func(model.Relation) model.Size) {
+	b.walkRow(getAncillaryRelations(table), drawRelation)
 
 	logrus.Infof("Drawing table %s at coord %v", table.Name, b.currentCoordinate)
-	relationSize := b.drawRelation(table.Relation)
+	relationSize := drawRelation(table.Relation)
 	b.currentCoordinate.AddHeight(relationSize)
 }
 
+// startDrawing starts the SVG and draws the controls, legend and panels
+func (b *BufferViz) startDrawing(width, height int) {
+	render.StartSVG(b.canvas, width, height)
+	b.drawControls()
+	b.drawLegend()
+	b.drawPanels()
+}
+
+func (b *BufferViz) DrawTable(table model.Table) {
+	b.startDrawing(b.setupTable(table))
+	b.walkTable(table, b.drawRelation)
+}
+
 func (b *BufferViz) AddFooter() {
 	x, y := b.coordinateToPosition(b.currentCoordinate)
 	b.canvas.Text(x, y, "Details: ", "id=\"details\"", "text-align:left;font-size:10px")
@@ -1,9 +1,12 @@
 package bufferviz
 
 import (
+	"bytes"
 	"testing"
 
+	svg "github.com/ajstarks/svgo"
 	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/bonnefoa/pg_buffer_viz/pkg/render"
 	"github.com/stretchr/testify/require"
 )
 
@@ -90,3 +93,119 @@ func TestAncillarySize(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatBlockRanges(t *testing.T) {
+	require.Equal(t, "", formatBlockRanges(nil))
+	require.Equal(t, "3", formatBlockRanges([]int{3}))
+	require.Equal(t, "1-4,7,9-10", formatBlockRanges([]int{1, 2, 3, 4, 7, 9, 10}))
+}
+
+func TestTreeBoxes(t *testing.T) {
+	nodes := []model.BtreeNode{
+		{BtreePage: model.BtreePage{Block: 1, LiveItems: 100}},
+		{BtreePage: model.BtreePage{Block: 2, LiveItems: 300}},
+	}
+	boxes := getTreeBoxes(nodes)
+	require.Len(t, boxes, 2)
+	require.Equal(t, 0, boxes[0].x)
+	require.Equal(t, treeWidth/4, boxes[0].width)
+	require.Equal(t, treeWidth*3/4, boxes[1].width)
+
+	many := make([]model.BtreeNode, 3*treeMaxNodes)
+	boxes = getTreeBoxes(many)
+	require.Len(t, boxes, treeMaxNodes)
+	require.Len(t, boxes[0].nodes, 3)
+}
+
+func TestPageTypeLegend(t *testing.T) {
+	table := getTestTable(4, []int{2}, 0, 0)
+	require.Empty(t, getPageTypeLegend(table))
+
+	table.Indexes[0].IndexPages = []model.IndexPage{
+		{Type: model.PageTypeGinPending}, {Type: model.PageTypeMeta},
+	}
+	require.Equal(t, []LegendEntry{
+		{"page-type-meta", "Metapage"},
+		{"page-type-gin-pending", "GIN pending list"},
+	}, getPageTypeLegend(table))
+}
+
+func TestTablePanels(t *testing.T) {
+	table := getTestTable(4, []int{2}, 0, 0)
+	table.Fsm = []int16{0, 100, model.MaxFreeSpace, model.MaxFreeSpace}
+	b := NewBufferViz(nil, model.Size{Width: 10, Height: 10}, model.Size{})
+	require.Empty(t, b.getTablePanels(table))
+
+	b.ShowBloat = true
+	b.ShowRecommendations = true
+	panels := b.getTablePanels(table)
+	require.Len(t, panels, 2)
+	require.Equal(t, "Estimated reclaimable space", panels[0].Title)
+	require.Len(t, panels[0].Lines, 2)
+	require.Contains(t, panels[0].Lines[0], "2 trailing blocks (16.0 kB) truncatable by VACUUM")
+	require.Equal(t, "Recommendations", panels[1].Title)
+	require.Equal(t, []string{
+		"1. VACUUM on TestRelation: VACUUM (VERBOSE) \"TestRelation\";",
+		"    - 2 empty trailing blocks (16.0 kB) can be truncated, estimated from the FSM",
+	}, panels[1].Lines)
+
+	table.TupleStats = &model.TupleStats{Approximate: true, TableLen: 32768, TupleCount: 10, TuplePercent: 1.5}
+	table.Indexes[0].IndexStats = &model.IndexStats{TreeLevel: 1, LeafPages: 3, AvgLeafDensity: 90}
+	b.panels = b.getTablePanels(table)
+	require.Len(t, b.panels, 3)
+	require.Equal(t, "Statistics", b.panels[1].Title)
+	require.Len(t, b.panels[1].Lines, 2)
+	require.Contains(t, b.panels[1].Lines[0], "pgstattuple_approx: 32768 bytes, 10 live tuples (1.5%)")
+	require.Contains(t, b.panels[1].Lines[1], "leaf density 90.0%")
+	require.Equal(t, 13, b.getPanelsSize().Height)
+}
+
+func TestIndexPageAttributes(t *testing.T) {
+	relation := getTestRelation(2)
+	relation.IndexPages = []model.IndexPage{
+		{Type: model.PageTypeGinPostingLeaf, LiveItems: 100, FreeSize: 2000, Next: -1},
+		{Type: model.PageTypeGinPostingLeaf, LiveItems: 50, FreeSize: 6000, Next: -1},
+	}
+	cells := relation.GetCells(2)
+	require.Equal(t, []string{
+		"data-page-type=\"gin-posting-leaf\"",
+		"data-items=\"150\" data-dead-items=\"0\"",
+		"data-page-free=\"4000\"",
+	}, getIndexPageAttributes(relation, cells[0]))
+}
+
+func TestDrawNewPage(t *testing.T) {
+	var out bytes.Buffer
+	DrawPage(svg.New(&out), model.Page{})
+	require.Contains(t, out.String(), "New page, not initialized")
+	require.NotContains(t, out.String(), "NaN")
+}
+
+func TestImageBounds(t *testing.T) {
+	table := getTestTable(1000000, []int{1000}, 0, 0)
+	iv := NewImageViz(&render.CanvasPng{}, model.Size{Width: 1, Height: 1}, model.Size{Width: 3, Height: 3})
+	iv.MaxCells = 16000000
+	iv.DrawTable(table)
+	// One pixel per block for the million blocks, plus the margins and the
+	// decorations
+	bounds := iv.image.Bounds()
+	require.Equal(t, 1003, bounds.Dx())
+	require.Less(t, bounds.Dy(), 1100)
+}
+
+func TestBrinCellClasses(t *testing.T) {
+	relation := getTestRelation(16)
+	relation.Brin = []model.BrinSummary{
+		model.NewBrinSummary("brin_a", 4, 16, map[int]string{0: "{1 .. 2}", 4: "{3 .. 4}"}),
+		model.NewBrinSummary("brin_b", 2, 16, map[int]string{}),
+	}
+	b := NewBufferViz(nil, model.Size{Width: 10, Height: 10}, model.Size{})
+	cell := model.Cell{StartBlock: 4, NumBlocks: 4}
+	require.Equal(t, "block fsm0 brin-odd", b.getCellClasses(relation, cell))
+
+	b.BrinIndex = "brin_b"
+	require.Equal(t, "block fsm0 brin-unsummarized brin-boundary", b.getCellClasses(relation, cell))
+
+	b.BrinIndex = "missing"
+	require.Equal(t, "block fsm0", b.getCellClasses(relation, cell))
+}
@@ -0,0 +1,23 @@
+package bufferviz
+
+import "github.com/bonnefoa/pg_buffer_viz/pkg/model"
+
+const controlsHeight = 20
+
+// getControlsSize returns the number of cells used by the controls
+func (b *BufferViz) getControlsSize() model.Size {
+	if !b.drawTexts {
+		return model.Size{}
+	}
+	return model.Size{Height: (controlsHeight + b.BlockSize.Height - 1) / b.BlockSize.Height}
+}
+
+// drawControls draws the search button and the text reporting the matched
+// blocks. They are handled by svg_functions.js.
+func (b *BufferViz) drawControls() {
+	x, y := b.coordinateToPosition(b.currentCoordinate)
+	y += controlsHeight - 6
+	b.canvas.Text(x, y, "Search", "id=\"search\"", "class=\"button\"")
+	b.canvas.Text(x+100, y, " ", "id=\"matched\"")
+	b.currentCoordinate.AddHeight(b.getControlsSize())
+}
@@ -0,0 +1,93 @@
+package bufferviz
+
+import (
+	"fmt"
+
+	svg "github.com/ajstarks/svgo"
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+)
+
+const (
+	chartWidth       = 800
+	chartHeight      = 300
+	chartAxisSpace   = 60
+	chartTitleHeight = 30
+	chartMargin      = 20
+)
+
+const chartCss = `
+text { font-family:"Verdana"; font-size:11px; }
+.chart-title { font-size:13px; font-weight:bold; }
+.chart-axis { stroke:rgb(0, 0, 0); stroke-width:1; }
+.chart-label { font-size:10px; fill:rgb(80, 80, 80); }
+.chart-ladder { fill:rgb(30, 60, 160); }
+`
+
+func getChartPanelHeight() int {
+	return chartTitleHeight + chartHeight + chartAxisSpace
+}
+
+// drawLadder draws the heap block of items in key order. Items sharing the
+// same pixel column are drawn as a line from their lowest to their highest
+// heap block.
+func drawLadder(canvas *svg.SVG, x int, y int, correlation model.IndexCorrelation, numHeapBlocks int) {
+	numItems := len(correlation.HeapBlocks)
+	if numItems == 0 || numHeapBlocks == 0 {
+		return
+	}
+	heapBlockToY := func(heapBlock int) int {
+		return y + chartHeight - int(float64(heapBlock)*float64(chartHeight)/float64(numHeapBlocks))
+	}
+	columns := min(chartWidth, numItems)
+	columnWidth := max(1, chartWidth/columns)
+	for column := range columns {
+		first := column * numItems / columns
+		last := max(first+1, (column+1)*numItems/columns)
+		lowest, highest := correlation.HeapBlocks[first], correlation.HeapBlocks[first]
+		for _, heapBlock := range correlation.HeapBlocks[first:last] {
+			lowest = min(lowest, heapBlock)
+			highest = max(highest, heapBlock)
+		}
+		top := heapBlockToY(highest + 1)
+		bottom := heapBlockToY(lowest)
+		canvas.Rect(x+column*chartWidth/columns, top, columnWidth, max(1, bottom-top), "class=\"chart-ladder\"")
+	}
+}
+
+func drawCorrelationPanel(canvas *svg.SVG, y int, correlation model.IndexCorrelation, numHeapBlocks int) {
+	x := chartAxisSpace
+	numItems := len(correlation.HeapBlocks)
+	canvas.Text(chartMargin, y+chartTitleHeight-10, fmt.Sprintf(
+		"%s: clustering factor %d for %d items over %d heap blocks, clustering ratio %.2f",
+		correlation.Index, correlation.ClusteringFactor, numItems,
+		correlation.NumHeapBlocks, correlation.GetClusteringRatio()), "class=\"chart-title\"")
+	y += chartTitleHeight
+
+	canvas.Line(x, y, x, y+chartHeight, "class=\"chart-axis\"")
+	canvas.Line(x, y+chartHeight, x+chartWidth, y+chartHeight, "class=\"chart-axis\"")
+	canvas.Text(x-4, y+8, fmt.Sprintf("%d", numHeapBlocks), "class=\"chart-label\"", "text-anchor=\"end\"")
+	canvas.Text(x-4, y+chartHeight, "0", "class=\"chart-label\"", "text-anchor=\"end\"")
+	canvas.Text(chartMargin, y+chartHeight/2, "heap block", "class=\"chart-label\"", "text-anchor=\"middle\"",
+		fmt.Sprintf("transform=\"rotate(-90 %d %d)\"", chartMargin, y+chartHeight/2))
+	canvas.Text(x, y+chartHeight+14, "0", "class=\"chart-label\"")
+	canvas.Text(x+chartWidth, y+chartHeight+14, fmt.Sprintf("%d", numItems), "class=\"chart-label\"", "text-anchor=\"end\"")
+	canvas.Text(x+chartWidth/2, y+chartHeight+14, "index items in key order", "class=\"chart-label\"", "text-anchor=\"middle\"")
+
+	drawLadder(canvas, x, y, correlation, numHeapBlocks)
+}
+
+// DrawCorrelations draws for each index the heap block pointed by its items
+// in key order. A well correlated index shows a diagonal, a poorly
+// correlated one is scattered over the heap.
+func DrawCorrelations(canvas *svg.SVG, table model.Table, correlations []model.IndexCorrelation) {
+	width := chartAxisSpace + chartWidth + chartMargin
+	height := max(1, len(correlations))*getChartPanelHeight() + chartMargin
+	canvas.Start(width, height)
+	canvas.Style("text/css", chartCss)
+	if len(correlations) == 0 {
+		canvas.Text(chartMargin, chartTitleHeight, fmt.Sprintf("No btree index on %s", table.Name), "class=\"chart-title\"")
+	}
+	for i, correlation := range correlations {
+		drawCorrelationPanel(canvas, i*getChartPanelHeight(), correlation, table.GetNumbBuffers())
+	}
+}
@@ -1,12 +1,17 @@
 package bufferviz
 
 import (
+	"github.com/bonnefoa/pg_buffer_viz/pkg/layout"
 	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
 	"github.com/sirupsen/logrus"
 )
 
+func (b *BufferViz) getGrid(relation model.Relation) layout.Grid {
+	return b.Layout.GetGrid(relation.GetNumCells(b.blocksPerCell), b.blocksPerCell)
+}
+
 func (b *BufferViz) getRelationSize(relation model.Relation) (res model.Size) {
-	res = relation.GetRelationSize()
+	res = b.getGrid(relation).Size()
 	res.Add(b.MarginSize)
 	if res.Width <= 5 {
 		res.Width = 10
@@ -15,24 +20,44 @@ func (b *BufferViz) getRelationSize(relation model.Relation) (res model.Size) {
 	return res
 }
 
-func (b *BufferViz) getAncillarySize(table model.Table) (res model.Size) {
-	for _, index := range table.Indexes {
-		res.AddWidthMaxHeight(b.getRelationSize(index))
+// getAncillaryRelations returns the indexes and toast relations drawn above
+// the table
+func getAncillaryRelations(table model.Table) []model.Relation {
+	relations := append([]model.Relation{}, table.Indexes...)
+	if table.Toast != nil {
+		relations = append(relations, table.Toast.Relation, table.Toast.Index)
 	}
+	return relations
+}
 
-	if table.Toast != nil {
-		toast := table.Toast
-		res.AddWidthMaxHeight(b.getRelationSize(toast.Relation))
-		res.AddWidthMaxHeight(b.getRelationSize(toast.Index))
+// getRowSize returns the number of cells used by relations drawn side by
+// side
+func (b *BufferViz) getRowSize(relations []model.Relation) (res model.Size) {
+	for _, relation := range relations {
+		res.AddWidthMaxHeight(b.getRelationSize(relation))
 	}
+	return res
+}
+
+func (b *BufferViz) getAncillarySize(table model.Table) (res model.Size) {
+	res = b.getRowSize(getAncillaryRelations(table))
 	// Add space for Details text
 	res.AddWidthMaxHeight(model.Size{Width: 0, Height: 2})
 	return res
 }
 
+// addDecorationsSize adds the space of the controls, legend and panels
+// drawn above the relations
+func (b *BufferViz) addDecorationsSize(res model.Size) model.Size {
+	res.AddHeightMaxWidth(b.getLegendSize())
+	res.AddHeightMaxWidth(b.getPanelsSize())
+	res.AddHeightMaxWidth(b.getControlsSize())
+	return res
+}
+
 func (b *BufferViz) getDrawSize(table model.Table) (res model.Size) {
 	res = b.getRelationSize(table.Relation)
 	ancillarySize := b.getAncillarySize(table)
 	res.AddHeightMaxWidth(ancillarySize)
-	return res
+	return b.addDecorationsSize(res)
 }
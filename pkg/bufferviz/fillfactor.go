@@ -0,0 +1,28 @@
+package bufferviz
+
+import (
+	"fmt"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+)
+
+// setupSimulation computes the aggregation level shared by the current and
+// predicted heaps and returns the size in pixels of the drawing
+func (b *BufferViz) setupSimulation(simulation model.FillfactorSimulation) (width, height int) {
+	b.setupCells(simulation.Current.GetNumbBuffers() + simulation.Predicted.GetNumbBuffers())
+	b.tableLegend = nil
+	b.highlightLabel = ""
+	b.panels = []Panel{{fmt.Sprintf("Rewrite with fillfactor %d", simulation.Fillfactor), simulation.GetSummary()}}
+	drawSize := b.getRowSize([]model.Relation{simulation.Current, simulation.Predicted})
+	// Add space for Details text
+	drawSize.AddHeightMaxWidth(model.Size{Width: 0, Height: 2})
+	drawSize = b.addDecorationsSize(drawSize)
+	return drawSize.Width * b.BlockSize.Width, drawSize.Height * b.BlockSize.Height
+}
+
+// DrawFillfactorSimulation draws the current heap and its predicted layout
+// after a rewrite side by side, with the same cell aggregation
+func (b *BufferViz) DrawFillfactorSimulation(simulation model.FillfactorSimulation) {
+	b.startDrawing(b.setupSimulation(simulation))
+	b.walkRow([]model.Relation{simulation.Current, simulation.Predicted}, b.drawRelation)
+}
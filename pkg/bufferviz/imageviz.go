@@ -0,0 +1,77 @@
+package bufferviz
+
+import (
+	"image/color"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/layout"
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/bonnefoa/pg_buffer_viz/pkg/render"
+)
+
+var (
+	segmentBoundaryColor = color.RGBA{0x3c, 0x3c, 0x3c, 0xff}
+	highlightColor       = color.RGBA{0xc8, 0x00, 0xc8, 0xff}
+)
+
+// ImageViz draws the table as a raster image, one rectangle of BlockSize
+// pixels per cell. Texts are not rendered.
+type ImageViz struct {
+	BufferViz
+	image *render.CanvasPng
+}
+
+func NewImageViz(image *render.CanvasPng, blockSize model.Size, marginSize model.Size) ImageViz {
+	iv := ImageViz{
+		BufferViz: NewBufferViz(nil, blockSize, marginSize),
+		image:     image,
+	}
+	// Texts can't be drawn, the legend and controls are left out
+	iv.drawTexts = false
+	return iv
+}
+
+func (iv *ImageViz) drawRelation(relation model.Relation) model.Size {
+	cells := relation.GetCells(iv.blocksPerCell)
+	grid := iv.Layout.GetGrid(len(cells), iv.blocksPerCell)
+	relationSize := grid.Size()
+
+	coordinate := iv.currentCoordinate
+	coordinate.Y += 1
+
+	// Keep a gap between blocks only when they are large enough
+	width, height := iv.BlockSize.Width, iv.BlockSize.Height
+	if width > 2 && height > 2 {
+		width, height = width-1, height-1
+	}
+	for i, cell := range cells {
+		position := grid.Position(i)
+		x, y := iv.coordinateToPosition(model.Coordinate{X: coordinate.X + position.X, Y: coordinate.Y + position.Y})
+		cellColor := render.FsmColor(int(cell.AvgFree / 32))
+		if cell.Highlight > 0 {
+			cellColor = highlightColor
+		}
+		iv.image.Rect(x, y, width, height, cellColor)
+	}
+
+	if annotator, ok := grid.(layout.Annotator); ok {
+		_, lines := annotator.Annotations(relation)
+		for _, line := range lines {
+			x1, y1 := iv.coordinateToPosition(model.Coordinate{X: coordinate.X + line.From.X, Y: coordinate.Y + line.From.Y})
+			x2, _ := iv.coordinateToPosition(model.Coordinate{X: coordinate.X + line.To.X, Y: coordinate.Y + line.To.Y})
+			iv.image.Rect(x1, y1, x2-x1, 1, segmentBoundaryColor)
+		}
+	}
+	relationSize.Add(iv.MarginSize)
+
+	return relationSize
+}
+
+func (iv *ImageViz) DrawTable(table model.Table) {
+	width, height := iv.setupTable(table)
+	iv.image.Start(width, height)
+	iv.walkTable(table, iv.drawRelation)
+}
+
+// AddFooter is a no-op as the image has no interactive details
+func (iv *ImageViz) AddFooter() {
+}
@@ -0,0 +1,116 @@
+package bufferviz
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/layout"
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+)
+
+// pageTypeEntries describes the index page types in legend order
+var pageTypeEntries = []LegendEntry{
+	{model.PageTypeMeta, "Metapage"},
+	{model.PageTypeGinEntryInternal, "GIN entry tree internal"},
+	{model.PageTypeGinEntryLeaf, "GIN entry tree leaf"},
+	{model.PageTypeGinPostingInternal, "GIN posting tree internal"},
+	{model.PageTypeGinPostingLeaf, "GIN posting tree leaf"},
+	{model.PageTypeGinPending, "GIN pending list"},
+	{model.PageTypeHashBucket, "Hash bucket"},
+	{model.PageTypeHashOverflow, "Hash overflow page"},
+	{model.PageTypeHashBitmap, "Hash bitmap page"},
+	{model.PageTypeGistInternal, "GiST internal"},
+	{model.PageTypeGistLeaf, "GiST leaf"},
+	{model.PageTypeSpgistInternal, "SP-GiST inner"},
+	{model.PageTypeSpgistLeaf, "SP-GiST leaf"},
+	{model.PageTypeDeleted, "Deleted page"},
+	{model.PageTypeUnused, "Unused page"},
+}
+
+func getPageTypeClass(pageType string) string {
+	return fmt.Sprintf("page-type-%s", pageType)
+}
+
+// getPageTypeLegend returns the legend entries of the page types found in
+// the table's indexes
+func getPageTypeLegend(table model.Table) []LegendEntry {
+	found := make(map[string]bool)
+	for _, relation := range table.GetRelations() {
+		for _, page := range relation.IndexPages {
+			found[page.Type] = true
+		}
+	}
+	entries := make([]LegendEntry, 0)
+	for _, entry := range pageTypeEntries {
+		if found[entry.Class] {
+			entries = append(entries, LegendEntry{getPageTypeClass(entry.Class), entry.Label})
+		}
+	}
+	if found[model.PageTypeGistInternal] || found[model.PageTypeGistLeaf] {
+		entries = append(entries, LegendEntry{"legend-follow-right", "GiST incomplete split"})
+	}
+	return entries
+}
+
+// getIndexPageAttributes returns the data attributes of cells of indexes
+// with page types, with the page's flags when the cell is a single block
+func getIndexPageAttributes(relation model.Relation, cell model.Cell) []string {
+	attributes := []string{
+		fmt.Sprintf("data-page-type=\"%s\"", cell.PageType),
+		fmt.Sprintf("data-items=\"%d\" data-dead-items=\"%d\"", cell.LiveItems, cell.DeadItems),
+		fmt.Sprintf("data-page-free=\"%d\"", cell.AvgPageFree),
+	}
+	if cell.NumBlocks != 1 || cell.StartBlock >= len(relation.IndexPages) {
+		return attributes
+	}
+	page := relation.IndexPages[cell.StartBlock]
+	if len(page.Flags) > 0 {
+		attributes = append(attributes, fmt.Sprintf("data-flags=\"%s\"", strings.Join(page.Flags, ",")))
+	}
+	if page.Next >= 0 {
+		attributes = append(attributes, fmt.Sprintf("data-next=\"%d\"", page.Next))
+	}
+	return attributes
+}
+
+// hasIncompleteSplit returns whether a GiST page of the cell has the
+// follow right flag set by an interrupted split
+func hasIncompleteSplit(relation model.Relation, cell model.Cell) bool {
+	for block := cell.StartBlock; block <= cell.GetEndBlock() && block < len(relation.IndexPages); block++ {
+		if slices.Contains(relation.IndexPages[block].Flags, "follow_right") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPageLinks(relation model.Relation) bool {
+	for _, page := range relation.IndexPages {
+		if page.Next >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// drawPageLinks draws the links between index pages, like overflow
+// chains. Links are only drawn when each cell is a single block.
+func (b *BufferViz) drawPageLinks(origin model.Coordinate, grid layout.Grid, relation model.Relation) {
+	if b.blocksPerCell != 1 {
+		return
+	}
+	center := func(block int) (int, int) {
+		position := grid.Position(block)
+		x, y := b.coordinateToPosition(model.Coordinate{X: origin.X + position.X, Y: origin.Y + position.Y})
+		return x + 2 + b.BlockSize.Width/2, y + 2 + b.BlockSize.Height/2
+	}
+	for block, page := range relation.IndexPages {
+		if page.Next < 0 || page.Next >= len(relation.IndexPages) {
+			continue
+		}
+		x1, y1 := center(block)
+		x2, y2 := center(page.Next)
+		b.canvas.Line(x1, y1, x2, y2, "class=\"page-link\"")
+	}
+}
@@ -0,0 +1,142 @@
+package bufferviz
+
+import (
+	"fmt"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+)
+
+const (
+	legendLineHeight = 14
+	legendStepWidth  = 8
+	legendLabelWidth = 150
+)
+
+// LegendEntry is a color class of a layer with its meaning
+type LegendEntry struct {
+	Class string
+	Label string
+}
+
+// Layer describes how cells are colored
+type Layer struct {
+	Name string
+	// Steps of the color scale from the lowest to the highest value, only
+	// steps with a label are annotated
+	Scale []LegendEntry
+	// Colors with a specific meaning
+	Special []LegendEntry
+}
+
+// FsmLayer colors cells with the free space reported by the FSM
+var FsmLayer = Layer{
+	Name:  "Free space (pg_freespace)",
+	Scale: getFsmScale(),
+	Special: []LegendEntry{
+		{"fsm0", "Full page, no free space"},
+		{"fsm255", "Empty page"},
+		{"legend-selected", "Hovered block"},
+	},
+}
+
+func getFsmScale() []LegendEntry {
+	scale := make([]LegendEntry, 0)
+	for fsmBucket := 0; fsmBucket <= 256; fsmBucket += 8 {
+		bucket := min(fsmBucket, 255)
+		label := ""
+		if bucket%64 == 0 || bucket == 255 {
+			freeBytes := bucket * 32
+			label = fmt.Sprintf("%d B (%d%%)", freeBytes, freeBytes*100/model.MaxFreeSpace)
+		}
+		scale = append(scale, LegendEntry{fmt.Sprintf("fsm%d", bucket), label})
+	}
+	return scale
+}
+
+// getTableLegend returns the legend entries of elements only drawn for
+// some tables
+func (b *BufferViz) getTableLegend(table model.Table) []LegendEntry {
+	entries := make([]LegendEntry, 0)
+	items, blocks := table.GetHighlightCount()
+	if table.HighlightLabel != "" {
+		entries = append(entries, LegendEntry{"legend-highlighted",
+			fmt.Sprintf("%s: %d in %d blocks", table.HighlightLabel, items, blocks)})
+	}
+	for _, brin := range table.Brin {
+		entries = append(entries, LegendEntry{"legend-brin-unsummarized",
+			fmt.Sprintf("%s: %d/%d ranges unsummarized", brin.Index, brin.GetNumUnsummarized(), len(brin.Ranges))})
+	}
+	if brin := b.getDrawnBrin(table.Relation); brin != nil {
+		entries = append(entries, LegendEntry{"legend-brin-odd",
+			fmt.Sprintf("Alternate ranges of %d pages of %s", brin.PagesPerRange, brin.Index)})
+		if b.blocksPerCell > 1 && brin.PagesPerRange%b.blocksPerCell != 0 {
+			entries = append(entries, LegendEntry{"legend-brin-boundary", "Cell spanning a range boundary"})
+		}
+	}
+	for _, relation := range table.GetRelations() {
+		if bloat := relation.GetBloat(); bloat.TruncatableBlocks > 0 {
+			label := fmt.Sprintf("%s: %d blocks truncatable", relation.Name, bloat.TruncatableBlocks)
+			if bloat.FsmEstimate {
+				label += " (FSM estimate)"
+			}
+			entries = append(entries, LegendEntry{"legend-truncatable", label})
+		}
+	}
+	entries = append(entries, getPageTypeLegend(table)...)
+	for _, relation := range table.GetRelations() {
+		if relation.HeapReferences != nil || hasPageLinks(*relation) {
+			entries = append(entries, LegendEntry{"legend-referenced", "Linked to hovered block"})
+			break
+		}
+	}
+	return entries
+}
+
+func (b *BufferViz) getSpecialEntries() []LegendEntry {
+	return append(append([]LegendEntry{}, b.Layer.Special...), b.tableLegend...)
+}
+
+// getLegendSize returns the number of cells used by the legend
+func (b *BufferViz) getLegendSize() model.Size {
+	if !b.drawTexts || b.Layer == nil {
+		return model.Size{}
+	}
+	height := 4 * legendLineHeight
+	width := max(len(b.Layer.Scale)*legendStepWidth, len(b.getSpecialEntries())*legendLabelWidth)
+	return model.Size{
+		Width:  (width + b.BlockSize.Width - 1) / b.BlockSize.Width,
+		Height: (height + b.BlockSize.Height - 1) / b.BlockSize.Height,
+	}
+}
+
+// drawLegend draws the active layer's color scale at the current coordinate
+func (b *BufferViz) drawLegend() {
+	if b.Layer == nil {
+		return
+	}
+	x, y := b.coordinateToPosition(b.currentCoordinate)
+	title := fmt.Sprintf("Legend: %s", b.Layer.Name)
+	if b.blocksPerCell > 1 {
+		title = fmt.Sprintf("%s, 1 cell = %d blocks colored by their average", title, b.blocksPerCell)
+	}
+	b.canvas.Text(x, y+legendLineHeight-4, title, "class=\"legend\"")
+
+	y += legendLineHeight
+	for i, entry := range b.Layer.Scale {
+		stepX := x + i*legendStepWidth
+		b.canvas.Rect(stepX, y, legendStepWidth, legendLineHeight-4, fmt.Sprintf("class=\"%s\"", entry.Class))
+		if entry.Label != "" {
+			b.canvas.Line(stepX, y, stepX, y+legendLineHeight, "class=\"legend-tick\"")
+			b.canvas.Text(stepX, y+2*legendLineHeight-4, entry.Label, "class=\"legend\"")
+		}
+	}
+
+	y += 2 * legendLineHeight
+	for i, entry := range b.getSpecialEntries() {
+		entryX := x + i*legendLabelWidth
+		b.canvas.Rect(entryX, y+2, legendLineHeight-4, legendLineHeight-4, fmt.Sprintf("class=\"%s\"", entry.Class))
+		b.canvas.Text(entryX+legendLineHeight, y+legendLineHeight-4, entry.Label, "class=\"legend\"")
+	}
+
+	b.currentCoordinate.AddHeight(b.getLegendSize())
+}
@@ -0,0 +1,201 @@
+package bufferviz
+
+import (
+	"fmt"
+
+	svg "github.com/ajstarks/svgo"
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+)
+
+const (
+	pageMapWidth     = 1024
+	pageMapBarHeight = 40
+	pageMapMargin    = 10
+)
+
+// pageMap draws the layout of a page to scale
+type pageMap struct {
+	canvas *svg.SVG
+	page   model.Page
+	scale  float64
+}
+
+func (p *pageMap) byteToX(offset int) int {
+	return pageMapMargin + int(float64(offset)*p.scale)
+}
+
+// drawRange draws the bytes [start, end) of the page with a title shown on hover
+func (p *pageMap) drawRange(start int, end int, class string, title string) {
+	if end <= start {
+		return
+	}
+	x := p.byteToX(start)
+	width := max(1, p.byteToX(end)-x)
+	p.canvas.Group()
+	p.canvas.Title(title)
+	p.canvas.Rect(x, pageMapMargin, width, pageMapBarHeight, fmt.Sprintf("class=\"%s\"", class))
+	p.canvas.Gend()
+}
+
+func (p *pageMap) drawScale(pageSize int) {
+	y := pageMapMargin + pageMapBarHeight
+	for offset := 0; offset <= pageSize; offset += 1024 {
+		x := p.byteToX(offset)
+		p.canvas.Line(x, y, x, y+5, "class=\"page-tick\"")
+		p.canvas.Text(x, y+16, fmt.Sprintf("%d", offset), "class=\"page-tick-label\"")
+	}
+}
+
+// DrawPage draws the line pointer map of a page: header, line pointers,
+// free space between pd_lower and pd_upper, tuples and special space
+func DrawPage(canvas *svg.SVG, page model.Page) {
+	header := page.Header
+	canvas.Start(pageMapWidth+2*pageMapMargin, pageMapBarHeight+2*pageMapMargin+20)
+	// A new page, zeroed by a relation extension not yet initialized, has
+	// no header to draw
+	if header.PageSize == 0 || header.Upper == 0 {
+		p := pageMap{canvas: canvas, page: page, scale: float64(pageMapWidth) / model.BlockSize}
+		p.drawRange(0, model.BlockSize, "page-unused", "New page, not initialized")
+		canvas.Text(pageMapMargin+pageMapWidth/2, pageMapMargin+pageMapBarHeight/2,
+			"New page", "class=\"page-new-label\"")
+		p.drawScale(model.BlockSize)
+		canvas.End()
+		return
+	}
+	p := pageMap{canvas: canvas, page: page, scale: float64(pageMapWidth) / float64(header.PageSize)}
+
+	// Tuple area background, parts not covered by tuples are unused space
+	p.drawRange(header.Upper, header.Special, "page-unused",
+		fmt.Sprintf("Tuple area %d-%d", header.Upper, header.Special))
+	p.drawRange(0, model.PageHeaderSize, "page-header",
+		fmt.Sprintf("Page header 0-%d", model.PageHeaderSize))
+	p.drawRange(model.PageHeaderSize, header.Lower, "page-lp",
+		fmt.Sprintf("Line pointers %d-%d (%d)", model.PageHeaderSize, header.Lower,
+			(header.Lower-model.PageHeaderSize)/model.ItemIdSize))
+	p.drawRange(header.Lower, header.Upper, "page-free",
+		fmt.Sprintf("Free space %d-%d (%d bytes)", header.Lower, header.Upper, header.Upper-header.Lower))
+	for _, item := range page.Items {
+		if item.LpLen == 0 || item.LpFlags == model.LpRedirect {
+			continue
+		}
+		class := "page-tuple"
+		if item.IsDead() {
+			class = "page-tuple-dead"
+		}
+		p.drawRange(item.LpOff, item.LpOff+item.LpLen, class,
+			fmt.Sprintf("lp %d (%s) %d-%d, %d bytes", item.Lp, item.GetLpFlagName(),
+				item.LpOff, item.LpOff+item.LpLen, item.LpLen))
+	}
+	p.drawRange(header.Special, header.PageSize, "page-special",
+		fmt.Sprintf("Special space %d-%d", header.Special, header.PageSize))
+	p.drawScale(header.PageSize)
+	canvas.End()
+}
+
+const (
+	hotBoxSize     = 24
+	hotBoxGap      = 8
+	hotBoxesPerRow = 32
+	// Space above each row for the arrows
+	hotArrowSpace = 30
+)
+
+// getHotBoxPosition returns the top left position of a line pointer's box
+func getHotBoxPosition(lp int) (x, y int) {
+	index := lp - 1
+	x = pageMapMargin + (index%hotBoxesPerRow)*(hotBoxSize+hotBoxGap)
+	y = pageMapMargin + hotArrowSpace + (index/hotBoxesPerRow)*(hotBoxSize+hotArrowSpace)
+	return x, y
+}
+
+func getHotBoxClass(item model.HeapItem) string {
+	class := "lp lp-" + item.GetLpFlagName()
+	if item.IsHeapOnly() {
+		class += " lp-heap-only"
+	}
+	if item.IsDead() {
+		class += " lp-dead"
+	}
+	return class
+}
+
+// drawHotArrow draws an arc from a line pointer to another
+func drawHotArrow(canvas *svg.SVG, from int, to int, class string) {
+	x1, y1 := getHotBoxPosition(from)
+	x2, y2 := getHotBoxPosition(to)
+	x1 += hotBoxSize / 2
+	x2 += hotBoxSize / 2
+	// Arc height grows with the distance to keep arrows apart
+	height := min(hotArrowSpace-4, 8+abs(to-from)*2)
+	path := fmt.Sprintf("M%d,%d C%d,%d %d,%d %d,%d", x1, y1, x1, y1-height, x2, y2-height, x2, y2)
+	canvas.Path(path, fmt.Sprintf("class=\"%s\"", class), "marker-end=\"url(#arrow)\"")
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// DrawHotChains draws one box per line pointer with arrows following HOT
+// chains: redirect line pointers and t_ctid links staying within the page
+func DrawHotChains(canvas *svg.SVG, page model.Page) {
+	numRows := (len(page.Items) + hotBoxesPerRow - 1) / hotBoxesPerRow
+	width := 2*pageMapMargin + hotBoxesPerRow*(hotBoxSize+hotBoxGap)
+	height := 2*pageMapMargin + numRows*(hotBoxSize+hotArrowSpace)
+	canvas.Start(width, height)
+	canvas.Def()
+	canvas.Marker("arrow", 6, 3, 6, 6, "orient=\"auto\"")
+	canvas.Path("M0,0 L6,3 L0,6 z", "class=\"hot-arrowhead\"")
+	canvas.MarkerEnd()
+	canvas.DefEnd()
+
+	for _, item := range page.Items {
+		x, y := getHotBoxPosition(item.Lp)
+		title := fmt.Sprintf("lp %d: %s", item.Lp, item.GetLpFlagName())
+		if item.LpFlags == model.LpRedirect {
+			title = fmt.Sprintf("%s to lp %d", title, item.LpOff)
+		} else if item.HasTuple {
+			title = fmt.Sprintf("%s, xmin %d, xmax %d, ctid (%d,%d) %v", title,
+				item.Xmin, item.Xmax, item.CtidBlock, item.CtidOffset, item.GetInfomaskFlags())
+		}
+		canvas.Group()
+		canvas.Title(title)
+		canvas.Rect(x, y, hotBoxSize, hotBoxSize, fmt.Sprintf("class=\"%s\"", getHotBoxClass(item)))
+		canvas.Text(x+hotBoxSize/2, y+hotBoxSize/2+4, fmt.Sprintf("%d", item.Lp), "class=\"lp-label\"")
+		canvas.Gend()
+	}
+
+	for _, item := range page.Items {
+		if item.LpFlags == model.LpRedirect {
+			drawHotArrow(canvas, item.Lp, item.LpOff, "hot-redirect")
+		} else if item.IsHotUpdated() && item.CtidBlock == int64(page.Block) && item.CtidOffset != item.Lp {
+			drawHotArrow(canvas, item.Lp, item.CtidOffset, "hot-update")
+		}
+	}
+	canvas.End()
+}
+
+// HotSummary counts the HOT chains of a page
+type HotSummary struct {
+	Chains    int
+	HeapOnly  int
+	Redirects int
+}
+
+func GetHotSummary(page model.Page) (summary HotSummary) {
+	for _, item := range page.Items {
+		if item.LpFlags == model.LpRedirect {
+			summary.Redirects++
+			summary.Chains++
+		}
+		if item.IsHeapOnly() {
+			summary.HeapOnly++
+		} else if item.IsHotUpdated() {
+			// Chain root still holding its tuple
+			summary.Chains++
+		}
+	}
+	return summary
+}
@@ -0,0 +1,100 @@
+package bufferviz
+
+import (
+	"fmt"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+)
+
+const (
+	panelLineHeight = 14
+	// Approximate width of a character of the panel's font
+	panelCharWidth = 6
+)
+
+// Panel is a block of text lines drawn above the relations
+type Panel struct {
+	Title string
+	Lines []string
+}
+
+// getTablePanels returns the panels describing the table
+func (b *BufferViz) getTablePanels(table model.Table) []Panel {
+	panels := make([]Panel, 0)
+	if b.ShowBloat {
+		bloatLines := make([]string, 0)
+		for _, bloat := range table.GetBloat() {
+			if bloat.Blocks > 0 {
+				bloatLines = append(bloatLines, fmt.Sprintf("%s: %s", bloat.Relation, bloat.String()))
+			}
+		}
+		if len(bloatLines) > 0 {
+			panels = append(panels, Panel{"Estimated reclaimable space", bloatLines})
+		}
+	}
+	stats := table.GetStats()
+	if len(stats) > 0 {
+		lines := make([]string, 0)
+		for _, s := range stats {
+			if s.Tuples != nil {
+				lines = append(lines, fmt.Sprintf("%s: %s", s.Relation, s.Tuples))
+			}
+			if s.Index != nil {
+				lines = append(lines, fmt.Sprintf("%s: %s", s.Relation, s.Index))
+			}
+		}
+		panels = append(panels, Panel{"Statistics", lines})
+	}
+	if !b.ShowRecommendations {
+		return panels
+	}
+	recommendations := table.GetRecommendations()
+	if len(recommendations) > 0 {
+		lines := make([]string, 0)
+		for i, r := range recommendations {
+			lines = append(lines, fmt.Sprintf("%d. %s", i+1, r.String()))
+			for _, evidence := range r.Evidence {
+				lines = append(lines, fmt.Sprintf("    - %s", evidence))
+			}
+		}
+		panels = append(panels, Panel{"Recommendations", lines})
+	}
+	return panels
+}
+
+// getPanelsSize returns the number of cells used by the panels
+func (b *BufferViz) getPanelsSize() model.Size {
+	if !b.drawTexts || len(b.panels) == 0 {
+		return model.Size{}
+	}
+	height := 0
+	width := 0
+	for _, panel := range b.panels {
+		height += (len(panel.Lines) + 1) * panelLineHeight
+		width = max(width, len(panel.Title)*panelCharWidth)
+		for _, line := range panel.Lines {
+			width = max(width, len(line)*panelCharWidth)
+		}
+	}
+	return model.Size{
+		Width:  (width + b.BlockSize.Width - 1) / b.BlockSize.Width,
+		Height: (height + b.BlockSize.Height - 1) / b.BlockSize.Height,
+	}
+}
+
+// drawPanels draws the panels' titles and lines at the current coordinate
+func (b *BufferViz) drawPanels() {
+	if !b.drawTexts || len(b.panels) == 0 {
+		return
+	}
+	x, y := b.coordinateToPosition(b.currentCoordinate)
+	for _, panel := range b.panels {
+		y += panelLineHeight
+		b.canvas.Text(x, y-4, panel.Title, "class=\"panel-title\"")
+		for _, line := range panel.Lines {
+			y += panelLineHeight
+			b.canvas.Text(x, y-4, line, "class=\"legend\"")
+		}
+	}
+	b.currentCoordinate.AddHeight(b.getPanelsSize())
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"context"
+	"slices"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/rotisserie/eris"
+	"github.com/sirupsen/logrus"
+)
+
+type visibilityResponse struct {
+	Block      int
+	AllVisible bool
+	AllFrozen  bool
+}
+
+type tuplesResponse struct {
+	Block     int
+	Live      int
+	Dead      int
+	LiveBytes int
+}
+
+// HasExtension checks whether an extension is installed in the database
+func (d *DbPool) HasExtension(ctx context.Context, extension string) (bool, error) {
+	var installed bool
+	err := d.QueryRow(ctx, "select exists(select 1 from pg_extension where extname=$1)", extension).Scan(&installed)
+	if err != nil {
+		return false, eris.Wrapf(err, "Error checking extension '%s'", extension)
+	}
+	return installed, nil
+}
+
+// checkExtension returns whether the extension is available, logging a
+// warning when it's missing
+func (d *DbPool) checkExtension(ctx context.Context, extension string) (bool, error) {
+	installed, err := d.HasExtension(ctx, extension)
+	if err == nil && !installed {
+		logrus.Warnf("Extension %s is not installed, skipping its information", extension)
+	}
+	return installed, err
+}
+
+// FetchCached returns which blocks of the relation are in shared buffers
+func (d *DbPool) FetchCached(ctx context.Context, oid uint32, numBlocks int) ([]bool, error) {
+	logrus.Debugf("Fetch cached blocks for oid '%d'", oid)
+	rows, err := d.Query(ctx, `SELECT relblocknumber FROM pg_buffercache
+WHERE relfilenode = pg_relation_filenode($1) AND relforknumber = 0
+AND reldatabase = (SELECT oid FROM pg_database WHERE datname = current_database())`, oid)
+	if err != nil {
+		return nil, eris.Wrap(err, "Fetch cached blocks failed")
+	}
+	blocks, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, eris.Wrap(err, "Error collecting cached blocks")
+	}
+	cached := make([]bool, numBlocks)
+	for _, block := range blocks {
+		if block < int64(numBlocks) {
+			cached[block] = true
+		}
+	}
+	return cached, nil
+}
+
+// FetchVisibility fills the all visible and all frozen flags of the relation
+func (d *DbPool) FetchVisibility(ctx context.Context, r *model.Relation, oid uint32) error {
+	logrus.Debugf("Fetch visibility map for oid '%d'", oid)
+	rows, err := d.Query(ctx, "SELECT blkno, all_visible, all_frozen FROM pg_visibility_map($1)", oid)
+	if err != nil {
+		return eris.Wrap(err, "Fetch visibility map failed")
+	}
+	visibilities, err := pgx.CollectRows(rows, pgx.RowToStructByPos[visibilityResponse])
+	if err != nil {
+		return eris.Wrap(err, "Error collecting visibility map")
+	}
+	numBlocks := r.GetNumbBuffers()
+	r.AllVisible = make([]bool, numBlocks)
+	r.AllFrozen = make([]bool, numBlocks)
+	for _, v := range visibilities {
+		if v.Block < numBlocks {
+			r.AllVisible[v.Block] = v.AllVisible
+			r.AllFrozen[v.Block] = v.AllFrozen
+		}
+	}
+	return nil
+}
+
+// FetchTuples counts live and dead tuples of every heap block using
+// pageinspect. Tuples are considered dead from their hint bits, without
+// checking their visibility.
+func (d *DbPool) FetchTuples(ctx context.Context, oid uint32) ([]model.TupleCount, error) {
+	logrus.Debugf("Fetch tuples for oid '%d'", oid)
+	rows, err := d.Query(ctx, `WITH items AS (
+    SELECT blkno, lp_flags, lp_len,
+        lp_flags = 3 OR (lp_flags = 1 AND (t_infomask & 1024) <> 0 AND (t_infomask & 128) = 0) AS dead
+    FROM generate_series(0, pg_relation_size($1) / current_setting('block_size')::bigint - 1) blkno
+    LEFT JOIN LATERAL heap_page_items(get_raw_page($1::regclass::text, blkno::int)) ON true
+) SELECT blkno,
+    count(*) FILTER (WHERE lp_flags = 1 AND NOT dead),
+    count(*) FILTER (WHERE dead),
+    coalesce(sum(lp_len) FILTER (WHERE lp_flags = 1 AND NOT dead), 0)
+FROM items GROUP BY blkno ORDER BY blkno`, oid)
+	if err != nil {
+		return nil, eris.Wrap(err, "Fetch tuples failed")
+	}
+	responses, err := pgx.CollectRows(rows, pgx.RowToStructByPos[tuplesResponse])
+	if err != nil {
+		return nil, eris.Wrap(err, "Error collecting tuples")
+	}
+	tuples := make([]model.TupleCount, len(responses))
+	for _, t := range responses {
+		tuples[t.Block] = model.TupleCount{Live: t.Live, Dead: t.Dead, LiveBytes: t.LiveBytes}
+	}
+	return tuples, nil
+}
+
+// fetchBlockDetails fetches the optional information common to all relations
+func (d *DbPool) fetchBlockDetails(ctx context.Context, r *model.Relation, oid uint32) error {
+	if !d.Buffers {
+		return nil
+	}
+	installed, err := d.checkExtension(ctx, "pg_buffercache")
+	if err != nil || !installed {
+		return err
+	}
+	r.Cached, err = d.FetchCached(ctx, oid, r.GetNumbBuffers())
+	return err
+}
+
+// fetchIndexDetails fetches the optional information only available on
+// indexes
+func (d *DbPool) fetchIndexDetails(ctx context.Context, r *model.Relation) error {
+	references := d.References && r.AccessMethod == "btree"
+	indexPages := d.IndexPages && slices.Contains([]string{"gin", "hash", "gist", "spgist"}, r.AccessMethod)
+	if !references && !indexPages {
+		return nil
+	}
+	installed, err := d.checkExtension(ctx, "pageinspect")
+	if err != nil || !installed {
+		return err
+	}
+	if references {
+		return d.FetchHeapReferences(ctx, r)
+	}
+	switch r.AccessMethod {
+	case "gin":
+		return d.FetchGinPages(ctx, r)
+	case "hash":
+		return d.FetchHashPages(ctx, r)
+	case "gist":
+		return d.FetchGistPages(ctx, r)
+	case "spgist":
+		return d.FetchSpgistPages(ctx, r)
+	}
+	return nil
+}
+
+// fetchHeapDetails fetches the optional information only available on heap
+func (d *DbPool) fetchHeapDetails(ctx context.Context, r *model.Relation, oid uint32) error {
+	if d.Visibility {
+		installed, err := d.checkExtension(ctx, "pg_visibility")
+		if err != nil {
+			return err
+		}
+		if installed {
+			err = d.FetchVisibility(ctx, r, oid)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if d.Tuples {
+		installed, err := d.checkExtension(ctx, "pageinspect")
+		if err != nil {
+			return err
+		}
+		if installed {
+			r.Tuples, err = d.FetchTuples(ctx, oid)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
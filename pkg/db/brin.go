@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/rotisserie/eris"
+	"github.com/sirupsen/logrus"
+)
+
+type brinItem struct {
+	Block int
+	Value string
+}
+
+// FetchBrinSummary reads the ranges summarized by a BRIN index. Only the
+// summaries of the index's first column are kept.
+func (d *DbPool) FetchBrinSummary(ctx context.Context, index model.Relation, numHeapBlocks int) (model.BrinSummary, error) {
+	logrus.Debugf("Fetch BRIN summaries of index '%s'", index.Name)
+	var pagesPerRange int
+	err := d.QueryRow(ctx, `SELECT pagesperrange::int
+FROM brin_metapage_info(get_raw_page($1::oid::regclass::text, 0))`, index.Oid).Scan(&pagesPerRange)
+	if err != nil {
+		return model.BrinSummary{}, eris.Wrap(err, "Fetch BRIN metapage failed")
+	}
+
+	// brin_page_items fails on revmap pages, regular pages are listed first
+	rows, err := d.Query(ctx, `SELECT blkno::int FROM generate_series(1, $2::int) blkno
+WHERE brin_page_type(get_raw_page($1::oid::regclass::text, blkno::int)) = 'regular'`,
+		index.Oid, index.GetNumbBuffers()-1)
+	if err != nil {
+		return model.BrinSummary{}, eris.Wrap(err, "Fetch BRIN page types failed")
+	}
+	regularPages, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return model.BrinSummary{}, eris.Wrap(err, "Error collecting BRIN page types")
+	}
+
+	rows, err = d.Query(ctx, `SELECT i.blknum::int, coalesce(i.value, 'all nulls')
+FROM unnest($2::int[]) blkno,
+LATERAL brin_page_items(get_raw_page($1::oid::regclass::text, blkno), $1::oid::regclass) i
+WHERE i.attnum = 1 AND NOT i.placeholder`, index.Oid, regularPages)
+	if err != nil {
+		return model.BrinSummary{}, eris.Wrap(err, "Fetch BRIN items failed")
+	}
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByPos[brinItem])
+	if err != nil {
+		return model.BrinSummary{}, eris.Wrap(err, "Error collecting BRIN items")
+	}
+	values := make(map[int]string)
+	for _, item := range items {
+		values[item.Block] = item.Value
+	}
+	return model.NewBrinSummary(index.Name, pagesPerRange, numHeapBlocks, values), nil
+}
+
+// fetchBrinSummaries fetches the ranges of the table's BRIN indexes
+func (d *DbPool) fetchBrinSummaries(ctx context.Context, table *model.Table) error {
+	if !d.Brin {
+		return nil
+	}
+	var installed bool
+	var err error
+	for _, index := range table.Indexes {
+		if index.AccessMethod != "brin" {
+			continue
+		}
+		if !installed {
+			installed, err = d.checkExtension(ctx, "pageinspect")
+			if err != nil || !installed {
+				return err
+			}
+		}
+		summary, err := d.FetchBrinSummary(ctx, index, table.GetNumbBuffers())
+		if err != nil {
+			return err
+		}
+		table.Brin = append(table.Brin, summary)
+	}
+	return nil
+}
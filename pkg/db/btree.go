@@ -0,0 +1,203 @@
+package db
+
+import (
+	"context"
+	"slices"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/rotisserie/eris"
+	"github.com/sirupsen/logrus"
+)
+
+// requirePageinspect fails when pageinspect, needed to read index pages,
+// isn't installed
+func (d *DbPool) requirePageinspect(ctx context.Context) error {
+	installed, err := d.HasExtension(ctx, "pageinspect")
+	if err != nil {
+		return err
+	}
+	if !installed {
+		return eris.New("Extension pageinspect is required to read index pages")
+	}
+	return nil
+}
+
+// FetchBtreePages fetches bt_page_stats of every page of the index except
+// the metapage
+func (d *DbPool) FetchBtreePages(ctx context.Context, index model.Relation) ([]model.BtreePage, error) {
+	logrus.Debugf("Fetch btree pages of index '%s'", index.Name)
+	rows, err := d.Query(ctx, `SELECT blkno::int, type::text, live_items, dead_items, free_size,
+    btpo_prev::bigint, btpo_next::bigint, btpo_level::int, btpo_flags
+FROM generate_series(1, $2::int) blkno,
+LATERAL bt_page_stats($1::oid::regclass::text, blkno)`, index.Oid, index.GetNumbBuffers()-1)
+	if err != nil {
+		return nil, eris.Wrap(err, "Fetch btree page stats failed")
+	}
+	pages, err := pgx.CollectRows(rows, pgx.RowToStructByPos[model.BtreePage])
+	if err != nil {
+		return nil, eris.Wrap(err, "Error collecting btree page stats")
+	}
+	return pages, nil
+}
+
+// FetchLeafPages returns the heap blocks referenced by the leaf pages of a
+// btree index in key order. Posting lists are expanded.
+func (d *DbPool) FetchLeafPages(ctx context.Context, index model.Relation) ([]model.LeafPage, error) {
+	pages, err := d.FetchBtreePages(ctx, index)
+	if err != nil {
+		return nil, err
+	}
+	chain := model.GetLevelChain(pages, 0)
+
+	batch := &pgx.Batch{}
+	for _, page := range chain {
+		batch.Queue(`SELECT (t::text::point)[0]::bigint
+FROM bt_page_items($1::oid::regclass::text, $2::int) i,
+LATERAL unnest(coalesce(i.tids, ARRAY[i.htid])) WITH ORDINALITY AS p(t, n)
+WHERE i.itemoffset >= $3 AND t IS NOT NULL
+ORDER BY i.itemoffset, n`, index.Oid, page.Block, page.GetFirstDataItem())
+	}
+	results := d.SendBatch(ctx, batch)
+	defer results.Close()
+
+	leaves := make([]model.LeafPage, 0, len(chain))
+	for _, page := range chain {
+		rows, err := results.Query()
+		if err != nil {
+			return nil, eris.Wrapf(err, "Fetch items of leaf page %d failed", page.Block)
+		}
+		heapBlocks, err := pgx.CollectRows(rows, pgx.RowTo[int])
+		if err != nil {
+			return nil, eris.Wrapf(err, "Error collecting items of leaf page %d", page.Block)
+		}
+		leaves = append(leaves, model.LeafPage{Block: page.Block, HeapBlocks: heapBlocks})
+	}
+	return leaves, nil
+}
+
+// FetchBtreeMeta fetches the metapage of a btree index
+func (d *DbPool) FetchBtreeMeta(ctx context.Context, index model.Relation) (model.BtreeMeta, error) {
+	logrus.Debugf("Fetch btree metapage of index '%s'", index.Name)
+	rows, err := d.Query(ctx, `SELECT root::int, level::int, fastroot::int, fastlevel::int
+FROM bt_metap($1::oid::regclass::text)`, index.Oid)
+	if err != nil {
+		return model.BtreeMeta{}, eris.Wrap(err, "Fetch btree metapage failed")
+	}
+	meta, err := pgx.CollectOneRow(rows, pgx.RowToStructByPos[model.BtreeMeta])
+	if err != nil {
+		return meta, eris.Wrap(err, "Error collecting btree metapage")
+	}
+	return meta, nil
+}
+
+// fetchDownlinks returns the child blocks of the internal pages in key order
+func (d *DbPool) fetchDownlinks(ctx context.Context, index model.Relation, pages []model.BtreePage) (map[int][]int, error) {
+	internalPages := make([]model.BtreePage, 0)
+	for _, page := range pages {
+		if page.Level > 0 && !page.IsDeleted() {
+			internalPages = append(internalPages, page)
+		}
+	}
+	batch := &pgx.Batch{}
+	for _, page := range internalPages {
+		batch.Queue(`SELECT (ctid::text::point)[0]::int
+FROM bt_page_items($1::oid::regclass::text, $2::int)
+WHERE itemoffset >= $3
+ORDER BY itemoffset`, index.Oid, page.Block, page.GetFirstDataItem())
+	}
+	results := d.SendBatch(ctx, batch)
+	defer results.Close()
+
+	downlinks := make(map[int][]int)
+	for _, page := range internalPages {
+		rows, err := results.Query()
+		if err != nil {
+			return nil, eris.Wrapf(err, "Fetch downlinks of page %d failed", page.Block)
+		}
+		downlinks[page.Block], err = pgx.CollectRows(rows, pgx.RowTo[int])
+		if err != nil {
+			return nil, eris.Wrapf(err, "Error collecting downlinks of page %d", page.Block)
+		}
+	}
+	return downlinks, nil
+}
+
+// FetchBtreeTree fetches the pages of a btree index arranged by level
+func (d *DbPool) FetchBtreeTree(ctx context.Context, index model.Relation) (model.BtreeTree, error) {
+	meta, err := d.FetchBtreeMeta(ctx, index)
+	if err != nil {
+		return model.BtreeTree{}, err
+	}
+	pages, err := d.FetchBtreePages(ctx, index)
+	if err != nil {
+		return model.BtreeTree{}, err
+	}
+	downlinks, err := d.fetchDownlinks(ctx, index, pages)
+	if err != nil {
+		return model.BtreeTree{}, err
+	}
+	return model.NewBtreeTree(index.Name, meta, pages, downlinks), nil
+}
+
+// FetchBtreeTrees fetches the structure of every btree index of the table
+func (d *DbPool) FetchBtreeTrees(ctx context.Context, table model.Table) ([]model.BtreeTree, error) {
+	err := d.requirePageinspect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	trees := make([]model.BtreeTree, 0)
+	for _, index := range table.Indexes {
+		if index.AccessMethod != "btree" {
+			continue
+		}
+		logrus.Infof("Fetch structure of index %s", index.Name)
+		tree, err := d.FetchBtreeTree(ctx, index)
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, tree)
+	}
+	return trees, nil
+}
+
+// FetchHeapReferences fills the heap blocks referenced by each leaf page
+// of a btree index
+func (d *DbPool) FetchHeapReferences(ctx context.Context, index *model.Relation) error {
+	leaves, err := d.FetchLeafPages(ctx, *index)
+	if err != nil {
+		return err
+	}
+	index.HeapReferences = make([][]int, index.GetNumbBuffers())
+	for _, leaf := range leaves {
+		if leaf.Block >= len(index.HeapReferences) {
+			continue
+		}
+		heapBlocks := slices.Clone(leaf.HeapBlocks)
+		slices.Sort(heapBlocks)
+		index.HeapReferences[leaf.Block] = slices.Compact(heapBlocks)
+	}
+	return nil
+}
+
+// FetchCorrelations computes the correlation between the key order and the
+// heap of every btree index of the table
+func (d *DbPool) FetchCorrelations(ctx context.Context, table model.Table) ([]model.IndexCorrelation, error) {
+	err := d.requirePageinspect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	correlations := make([]model.IndexCorrelation, 0)
+	for _, index := range table.Indexes {
+		if index.AccessMethod != "btree" {
+			continue
+		}
+		logrus.Infof("Fetch correlation of index %s", index.Name)
+		leaves, err := d.FetchLeafPages(ctx, index)
+		if err != nil {
+			return nil, err
+		}
+		correlations = append(correlations, model.NewIndexCorrelation(index.Name, leaves))
+	}
+	return correlations, nil
+}
@@ -1,23 +1,58 @@
 package db
 
 import (
+	"time"
+
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
+// FetchOptions selects the optional per-block information to fetch
+type FetchOptions struct {
+	Buffers    bool
+	Visibility bool
+	Tuples     bool
+	References bool
+	Brin       bool
+	IndexPages bool
+	Stats      bool
+	// Heaps above this size use pgstattuple_approx
+	ExactStatsMaxBlocks int
+}
+
 type DbConfigCli struct {
-	ConnectUrl string
-	Relation   string
+	ConnectUrl       string
+	Relation         string
+	UserQueryTimeout time.Duration
+	FetchOptions
 }
 
 func SetDbConfigFlags(fs *pflag.FlagSet) {
 	fs.String("connect-url", "", "Connection url to PostgreSQL db")
 	fs.String("relation", "", "Target relation")
+	fs.Bool("fetch-buffers", false, "Fetch blocks residency in shared buffers, requires pg_buffercache")
+	fs.Bool("fetch-visibility", false, "Fetch visibility map of heap blocks, requires pg_visibility")
+	fs.Bool("fetch-tuples", false, "Fetch tuple counts of heap blocks by reading every block, requires pageinspect")
+	fs.Bool("fetch-brin", true, "Fetch block ranges summarized by BRIN indexes, requires pageinspect")
+	fs.Bool("fetch-index-pages", false, "Fetch page types of gin, hash, gist and spgist indexes by reading every page, requires pageinspect")
+	fs.Bool("fetch-stats", false, "Fetch pgstattuple statistics of heap and toast and pgstatindex of btree indexes, requires pgstattuple")
+	fs.Int("exact-stats-max-blocks", 131072, "Heaps with more blocks use pgstattuple_approx instead of the exact pgstattuple")
+	fs.Duration("user-query-timeout", 30*time.Second, "statement_timeout of the queries used to highlight or trace blocks, 0 keeps the server's")
+	fs.Bool("fetch-references", false, "Fetch heap blocks referenced by btree leaf pages by reading every leaf, requires pageinspect")
 }
 
 func GetDbConfigCli() DbConfigCli {
 	d := DbConfigCli{}
 	d.ConnectUrl = viper.GetString("connect-url")
 	d.Relation = viper.GetString("relation")
+	d.UserQueryTimeout = viper.GetDuration("user-query-timeout")
+	d.Buffers = viper.GetBool("fetch-buffers")
+	d.Visibility = viper.GetBool("fetch-visibility")
+	d.Tuples = viper.GetBool("fetch-tuples")
+	d.References = viper.GetBool("fetch-references")
+	d.Brin = viper.GetBool("fetch-brin")
+	d.IndexPages = viper.GetBool("fetch-index-pages")
+	d.Stats = viper.GetBool("fetch-stats")
+	d.ExactStatsMaxBlocks = viper.GetInt("exact-stats-max-blocks")
 	return d
 }
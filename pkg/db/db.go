@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
 	"github.com/jackc/pgx/v5"
@@ -13,6 +14,9 @@ import (
 
 type DbPool struct {
 	*pgxpool.Pool
+	FetchOptions
+	// statement_timeout of user provided queries, 0 keeps the server's
+	UserQueryTimeout time.Duration
 }
 
 func NewDbPool(ctx context.Context, connectUrl string) (*DbPool, error) {
@@ -25,7 +29,7 @@ func NewDbPool(ctx context.Context, connectUrl string) (*DbPool, error) {
 	if err != nil {
 		return nil, eris.Wrap(err, "Error creating pgxpool")
 	}
-	return &DbPool{pool}, nil
+	return &DbPool{Pool: pool}, nil
 }
 
 func (d *DbPool) FetchFsmFromOid(ctx context.Context, oid uint32) ([]int16, error) {
@@ -46,24 +50,81 @@ func (d *DbPool) FetchFsm(ctx context.Context, relationName string) ([]int16, er
 	return pgx.CollectRows(rows, pgx.RowTo[int16])
 }
 
+// FetchFilepath returns the path of the relation's first segment file
+func (d *DbPool) FetchFilepath(ctx context.Context, oid uint32) (string, error) {
+	logrus.Debugf("Fetch file path for oid '%d'", oid)
+	var filepath string
+	err := d.QueryRow(ctx, "select pg_relation_filepath($1)", oid).Scan(&filepath)
+	if err != nil {
+		return "", eris.Wrap(err, "Fetch file path failed")
+	}
+	return filepath, nil
+}
+
+func (d *DbPool) FetchOid(ctx context.Context, relationName string) (uint32, error) {
+	var oid uint32
+	err := d.QueryRow(ctx, "select $1::regclass::oid", relationName).Scan(&oid)
+	if err != nil {
+		return 0, eris.Wrapf(err, "Fetch oid of relation '%s' failed", relationName)
+	}
+	return oid, nil
+}
+
+// FetchQualifiedName returns the relation's name usable in a statement
+func (d *DbPool) FetchQualifiedName(ctx context.Context, oid uint32) (string, error) {
+	var name string
+	err := d.QueryRow(ctx, "select $1::oid::regclass::text", oid).Scan(&name)
+	if err != nil {
+		return "", eris.Wrap(err, "Fetch qualified name failed")
+	}
+	return name, nil
+}
+
 func (d *DbPool) FetchRelationFromOid(ctx context.Context, relationName string, oid uint32) (model.Relation, error) {
-	avails, err := d.FetchFsmFromOid(ctx, oid)
-	r := model.Relation{
-		Name: relationName,
-		Fsm:  avails,
+	r := model.Relation{Name: relationName, Oid: oid}
+	var err error
+	r.QualifiedName, err = d.FetchQualifiedName(ctx, oid)
+	if err != nil {
+		return r, err
+	}
+	r.Fsm, err = d.FetchFsmFromOid(ctx, oid)
+	if err != nil {
+		return r, err
 	}
+	r.Filepath, err = d.FetchFilepath(ctx, oid)
+	if err != nil {
+		return r, err
+	}
+	err = d.fetchBlockDetails(ctx, &r, oid)
 	return r, err
 }
 
-func (d *DbPool) FetchRelation(ctx context.Context, relationName string) (model.Relation, error) {
-	avails, err := d.FetchFsm(ctx, relationName)
-	r := model.Relation{
-		Name: relationName,
-		Fsm:  avails,
+// FetchHeapFromOid fetches a relation with the information specific to heap
+func (d *DbPool) FetchHeapFromOid(ctx context.Context, relationName string, oid uint32) (model.Relation, error) {
+	r, err := d.FetchRelationFromOid(ctx, relationName, oid)
+	if err != nil {
+		return r, err
 	}
+	err = d.fetchHeapDetails(ctx, &r, oid)
 	return r, err
 }
 
+func (d *DbPool) FetchHeap(ctx context.Context, relationName string) (model.Relation, error) {
+	oid, err := d.FetchOid(ctx, relationName)
+	if err != nil {
+		return model.Relation{Name: relationName}, err
+	}
+	return d.FetchHeapFromOid(ctx, relationName, oid)
+}
+
+func (d *DbPool) FetchRelation(ctx context.Context, relationName string) (model.Relation, error) {
+	oid, err := d.FetchOid(ctx, relationName)
+	if err != nil {
+		return model.Relation{Name: relationName}, err
+	}
+	return d.FetchRelationFromOid(ctx, relationName, oid)
+}
+
 func (d *DbPool) ListRelationNames(ctx context.Context) ([]string, error) {
 	rows, err := d.Query(ctx, "select relname from pg_class where relkind='r' order by oid desc")
 	if err != nil {
@@ -76,19 +137,45 @@ func (d *DbPool) ListRelationNames(ctx context.Context) ([]string, error) {
 	return relationNames, err
 }
 
-func (d *DbPool) FetchIndexes(ctx context.Context, relationName string) ([]model.Relation, error) {
-	logrus.Debugf("Fetch indexes for relation '%s'", relationName)
-	rows, err := d.Query(ctx, "select indexname from pg_indexes where tablename=$1", relationName)
+type indexResponse struct {
+	Oid          uint32
+	IndexName    string
+	AccessMethod string
+}
+
+// fetchIndexResponses lists the indexes of a relation
+func (d *DbPool) fetchIndexResponses(ctx context.Context, relationName string) ([]indexResponse, error) {
+	rows, err := d.Query(ctx, `SELECT c.oid, c.relname, am.amname
+FROM pg_index i
+JOIN pg_class c ON c.oid = i.indexrelid
+JOIN pg_am am ON am.oid = c.relam
+WHERE i.indrelid = $1::regclass
+ORDER BY c.relname`, relationName)
 	if err != nil {
 		return nil, eris.Wrap(err, "Fetch index name failed")
 	}
-	indexNames, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	indexResponses, err := pgx.CollectRows(rows, pgx.RowToStructByPos[indexResponse])
 	if err != nil {
 		return nil, eris.Wrap(err, "Reading index failed")
 	}
+	return indexResponses, nil
+}
+
+func (d *DbPool) FetchIndexes(ctx context.Context, relationName string) ([]model.Relation, error) {
+	logrus.Debugf("Fetch indexes for relation '%s'", relationName)
+	indexResponses, err := d.fetchIndexResponses(ctx, relationName)
+	if err != nil {
+		return nil, err
+	}
 	indexes := make([]model.Relation, 0)
-	for _, indexName := range indexNames {
-		r, err := d.FetchRelation(ctx, indexName)
+	for _, indexResponse := range indexResponses {
+		r, err := d.FetchRelationFromOid(ctx, indexResponse.IndexName, indexResponse.Oid)
+		if err != nil {
+			return nil, err
+		}
+		r.AccessMethod = indexResponse.AccessMethod
+		r.Heap = relationName
+		err = d.fetchIndexDetails(ctx, &r)
 		if err != nil {
 			return nil, err
 		}
@@ -104,29 +191,39 @@ type ToastResponse struct {
 	IndexName    string
 }
 
-func (d *DbPool) FetchToast(ctx context.Context, relationName string) (*model.Toast, error) {
-	logrus.Debugf("Fetch toast for relation '%s'", relationName)
+// fetchToastResponse returns the toast of a relation and its index, nil
+// when the relation has no toast
+func (d *DbPool) fetchToastResponse(ctx context.Context, relationName string) (*ToastResponse, error) {
 	rows, err := d.Query(ctx, `WITH toast_ids AS (
     SELECT c.reltoastrelid as oid, i.indexrelid as idx_oid
     FROM pg_class c, pg_index i
     WHERE relname=$1
     AND i.indrelid = c.reltoastrelid
-) SELECT t_oids.oid, t.relname, t_oids.idx_oid, ti.relname
+) SELECT t_oids.oid, t.oid::regclass::text, t_oids.idx_oid, ti.oid::regclass::text
 FROM pg_class t, pg_class ti, toast_ids t_oids
 WHERE t.oid = t_oids.oid AND ti.oid = t_oids.idx_oid`, relationName)
 	if err != nil {
 		return nil, eris.Wrap(err, "Toast query failed")
 	}
 
-	toastResponse, err := pgx.CollectOneRow(rows, pgx.RowToStructByPos[ToastResponse])
+	toastResponse, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByPos[ToastResponse])
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, eris.Wrap(err, "Error collecting toast response")
 	}
+	return toastResponse, nil
+}
+
+func (d *DbPool) FetchToast(ctx context.Context, relationName string) (*model.Toast, error) {
+	logrus.Debugf("Fetch toast for relation '%s'", relationName)
+	toastResponse, err := d.fetchToastResponse(ctx, relationName)
+	if err != nil || toastResponse == nil {
+		return nil, err
+	}
 
-	relation, err := d.FetchRelationFromOid(ctx, toastResponse.RelationName, toastResponse.ToastOid)
+	relation, err := d.FetchHeapFromOid(ctx, toastResponse.RelationName, toastResponse.ToastOid)
 	if err != nil {
 		return nil, err
 	}
@@ -134,12 +231,19 @@ WHERE t.oid = t_oids.oid AND ti.oid = t_oids.idx_oid`, relationName)
 	if err != nil {
 		return nil, err
 	}
+	// Toast indexes are always btree
+	index.AccessMethod = "btree"
+	index.Heap = toastResponse.RelationName
+	err = d.fetchIndexDetails(ctx, &index)
+	if err != nil {
+		return nil, err
+	}
 	return &model.Toast{Relation: relation, Index: index}, nil
 }
 
 func (d *DbPool) FetchTable(ctx context.Context, relationName string) (table model.Table, err error) {
 	logrus.Infof("Fetch buffer information for table '%s'", relationName)
-	table.Relation, err = d.FetchRelation(ctx, relationName)
+	table.Relation, err = d.FetchHeap(ctx, relationName)
 	if err != nil {
 		return
 	}
@@ -148,5 +252,43 @@ func (d *DbPool) FetchTable(ctx context.Context, relationName string) (table mod
 		return
 	}
 	table.Toast, err = d.FetchToast(ctx, relationName)
+	if err != nil {
+		return
+	}
+	err = d.fetchBrinSummaries(ctx, &table)
+	if err != nil {
+		return
+	}
+	err = d.fetchStats(ctx, &table)
+	return
+}
+
+// FetchTableRelations fetches the names, oids and access methods of the
+// table's relations without any block information
+func (d *DbPool) FetchTableRelations(ctx context.Context, relationName string) (table model.Table, err error) {
+	logrus.Debugf("Fetch relations of table '%s'", relationName)
+	table.Name = relationName
+	table.Oid, err = d.FetchOid(ctx, relationName)
+	if err != nil {
+		return
+	}
+	indexResponses, err := d.fetchIndexResponses(ctx, relationName)
+	if err != nil {
+		return
+	}
+	table.Indexes = make([]model.Relation, 0, len(indexResponses))
+	for _, r := range indexResponses {
+		table.Indexes = append(table.Indexes, model.Relation{Name: r.IndexName, Oid: r.Oid,
+			AccessMethod: r.AccessMethod, Heap: relationName})
+	}
+	toastResponse, err := d.fetchToastResponse(ctx, relationName)
+	if err != nil || toastResponse == nil {
+		return
+	}
+	table.Toast = &model.Toast{
+		Relation: model.Relation{Name: toastResponse.RelationName, Oid: toastResponse.ToastOid},
+		Index: model.Relation{Name: toastResponse.IndexName, Oid: toastResponse.IndexOid,
+			AccessMethod: "btree", Heap: toastResponse.RelationName},
+	}
 	return
 }
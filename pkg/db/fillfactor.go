@@ -0,0 +1,23 @@
+package db
+
+import (
+	"context"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+)
+
+// SimulateFillfactor predicts the layout of the table's heap after a
+// rewrite with the fillfactor. Tuples are fetched when they weren't.
+func (d *DbPool) SimulateFillfactor(ctx context.Context, table *model.Table, fillfactor int) (model.FillfactorSimulation, error) {
+	if table.Tuples == nil {
+		err := d.requirePageinspect(ctx)
+		if err != nil {
+			return model.FillfactorSimulation{}, err
+		}
+		table.Tuples, err = d.FetchTuples(ctx, table.Oid)
+		if err != nil {
+			return model.FillfactorSimulation{}, err
+		}
+	}
+	return model.NewFillfactorSimulation(table.Relation, fillfactor)
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/rotisserie/eris"
+	"github.com/sirupsen/logrus"
+)
+
+type pageSpaceResponse struct {
+	Block int
+	Lower int
+	Upper int
+}
+
+// FetchPageSpace returns the free space bounds of the blocks from their
+// page header
+func (d *DbPool) FetchPageSpace(ctx context.Context, oid uint32, blocks []int) (map[int]model.PageSpace, error) {
+	logrus.Debugf("Fetch %d page headers for oid '%d'", len(blocks), oid)
+	rows, err := d.Query(ctx, `SELECT blkno, h.lower::int, h.upper::int
+FROM unnest($2::int[]) blkno,
+LATERAL page_header(get_raw_page($1::oid::regclass::text, blkno)) h`, oid, blocks)
+	if err != nil {
+		return nil, eris.Wrap(err, "Fetch page headers failed")
+	}
+	responses, err := pgx.CollectRows(rows, pgx.RowToStructByPos[pageSpaceResponse])
+	if err != nil {
+		return nil, eris.Wrap(err, "Error collecting page headers")
+	}
+	pageSpace := make(map[int]model.PageSpace, len(responses))
+	for _, r := range responses {
+		pageSpace[r.Block] = model.PageSpace{Lower: r.Lower, Upper: r.Upper}
+	}
+	return pageSpace, nil
+}
+
+// FetchFillfactor returns the fillfactor of a relation from its reloptions,
+// 100 when it isn't set
+func (d *DbPool) FetchFillfactor(ctx context.Context, oid uint32) (int, error) {
+	var fillfactor int
+	err := d.QueryRow(ctx, `SELECT coalesce((SELECT option_value::int
+    FROM pg_options_to_table(c.reloptions) WHERE option_name = 'fillfactor'), 100)
+FROM pg_class c WHERE c.oid = $1`, oid).Scan(&fillfactor)
+	if err != nil {
+		return 0, eris.Wrap(err, "Fetch fillfactor failed")
+	}
+	return fillfactor, nil
+}
+
+// HighlightInserts simulates inserts in the table's heap, with the table's
+// fillfactor when fillfactor is 0. The page headers of the blocks inserts
+// can land in are fetched when they weren't, the FSM is used without
+// pageinspect.
+func (d *DbPool) HighlightInserts(ctx context.Context, table *model.Table, tupleSize int, fillfactor int) (model.InsertSimulation, error) {
+	var err error
+	if fillfactor == 0 {
+		fillfactor, err = d.FetchFillfactor(ctx, table.Oid)
+		if err != nil {
+			return model.InsertSimulation{}, err
+		}
+	}
+	candidates, err := table.GetInsertCandidates(tupleSize, fillfactor)
+	if err != nil {
+		return model.InsertSimulation{}, err
+	}
+	missing := make([]int, 0)
+	for _, block := range candidates {
+		if _, ok := table.PageSpace[block]; !ok {
+			missing = append(missing, block)
+		}
+	}
+	if len(missing) > 0 {
+		installed, err := d.checkExtension(ctx, "pageinspect")
+		if err != nil {
+			return model.InsertSimulation{}, err
+		}
+		if !installed {
+			logrus.Warn("Free space of heap pages is taken from the FSM, which only VACUUM updates")
+			return table.HighlightInserts(tupleSize, fillfactor)
+		}
+		pageSpace, err := d.FetchPageSpace(ctx, table.Oid, missing)
+		if err != nil {
+			return model.InsertSimulation{}, err
+		}
+		if table.PageSpace == nil {
+			table.PageSpace = make(map[int]model.PageSpace)
+		}
+		for block, space := range pageSpace {
+			table.PageSpace[block] = space
+		}
+	}
+	return table.HighlightInserts(tupleSize, fillfactor)
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"slices"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/rotisserie/eris"
+	"github.com/sirupsen/logrus"
+)
+
+type ginPageResponse struct {
+	Block     int
+	Flags     []string
+	MaxOff    int
+	FreeSize  int
+	RightLink int64
+}
+
+// invalidBlockNumber marks the absence of a right link
+const invalidBlockNumber = 0xFFFFFFFF
+
+// FetchGinMeta fetches the metapage of a GIN index
+func (d *DbPool) FetchGinMeta(ctx context.Context, index model.Relation) (model.GinMeta, error) {
+	rows, err := d.Query(ctx, `SELECT n_pending_pages, n_pending_tuples, n_total_pages,
+    n_entry_pages, n_data_pages, n_entries
+FROM gin_metapage_info(get_raw_page($1::oid::regclass::text, 0))`, index.Oid)
+	if err != nil {
+		return model.GinMeta{}, eris.Wrap(err, "Fetch GIN metapage failed")
+	}
+	meta, err := pgx.CollectOneRow(rows, pgx.RowToStructByPos[model.GinMeta])
+	if err != nil {
+		return meta, eris.Wrap(err, "Error collecting GIN metapage")
+	}
+	return meta, nil
+}
+
+// fetchGinPostingItems counts the heap pointers of compressed posting tree
+// leaves
+func (d *DbPool) fetchGinPostingItems(ctx context.Context, index model.Relation, blocks []int) ([]blockCount, error) {
+	rows, err := d.Query(ctx, `SELECT blkno, sum(cardinality(i.tids))::int
+FROM unnest($2::int[]) blkno,
+LATERAL gin_leafpage_items(get_raw_page($1::oid::regclass::text, blkno)) i
+GROUP BY blkno`, index.Oid, blocks)
+	if err != nil {
+		return nil, eris.Wrap(err, "Fetch GIN posting items failed")
+	}
+	counts, err := pgx.CollectRows(rows, pgx.RowToStructByPos[blockCount])
+	if err != nil {
+		return nil, eris.Wrap(err, "Error collecting GIN posting items")
+	}
+	return counts, nil
+}
+
+// FetchGinPages fills the page types of a GIN index with its pending list
+// size. Items of entry tree pages are index tuples, items of posting tree
+// leaves are heap pointers.
+func (d *DbPool) FetchGinPages(ctx context.Context, index *model.Relation) error {
+	logrus.Debugf("Fetch GIN pages of index '%s'", index.Name)
+	meta, err := d.FetchGinMeta(ctx, *index)
+	if err != nil {
+		return err
+	}
+	rows, err := d.Query(ctx, `SELECT blkno::int, o.flags::text[], o.maxoff::int,
+    (h.upper - h.lower)::int, o.rightlink::bigint
+FROM generate_series(0, $2::int) blkno,
+LATERAL get_raw_page($1::oid::regclass::text, blkno::int) raw,
+LATERAL gin_page_opaque_info(raw) o,
+LATERAL page_header(raw) h`, index.Oid, index.GetNumbBuffers()-1)
+	if err != nil {
+		return eris.Wrap(err, "Fetch GIN pages failed")
+	}
+	responses, err := pgx.CollectRows(rows, pgx.RowToStructByPos[ginPageResponse])
+	if err != nil {
+		return eris.Wrap(err, "Error collecting GIN pages")
+	}
+
+	index.IndexPages = make([]model.IndexPage, index.GetNumbBuffers())
+	compressedLeaves := make([]int, 0)
+	for _, r := range responses {
+		if r.Block >= len(index.IndexPages) {
+			continue
+		}
+		page := model.IndexPage{
+			Type:      model.GetGinPageType(r.Flags),
+			LiveItems: r.MaxOff,
+			FreeSize:  r.FreeSize,
+			Next:      -1,
+			Flags:     r.Flags,
+		}
+		if page.Type == model.PageTypeGinPending && r.RightLink != invalidBlockNumber {
+			page.Next = int(r.RightLink)
+		}
+		if page.Type == model.PageTypeGinPostingLeaf && slices.Contains(r.Flags, "compressed") {
+			compressedLeaves = append(compressedLeaves, r.Block)
+		}
+		index.IndexPages[r.Block] = page
+	}
+
+	counts, err := d.fetchGinPostingItems(ctx, *index, compressedLeaves)
+	if err != nil {
+		return err
+	}
+	for _, c := range counts {
+		index.IndexPages[c.Block].LiveItems = c.Count
+	}
+	index.Summary = meta.GetSummary()
+	return nil
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"slices"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/rotisserie/eris"
+	"github.com/sirupsen/logrus"
+)
+
+type gistPageResponse struct {
+	Block     int
+	Flags     []string
+	Nsn       string
+	RightLink int64
+	FreeSize  int
+}
+
+type itemCountResponse struct {
+	Block     int
+	LiveItems int
+	DeadItems int
+}
+
+type spgistPageResponse struct {
+	Block    int
+	Special  []byte
+	NumItems int
+	FreeSize int
+}
+
+// FetchGistPages fills the page types of a GiST index. Pages with an
+// incomplete split are linked to their right sibling. New zeroed pages, on
+// which gist_page_opaque_info fails before PostgreSQL 16, are unused.
+func (d *DbPool) FetchGistPages(ctx context.Context, index *model.Relation) error {
+	logrus.Debugf("Fetch GiST pages of index '%s'", index.Name)
+	// OFFSET 0 keeps zeroed pages filtered before reading their opaque data
+	rows, err := d.Query(ctx, `SELECT p.blkno::int, o.flags::text[], o.nsn::text, o.rightlink::bigint,
+    (p.upper - p.lower)::int
+FROM (SELECT blkno, raw, h.lower, h.upper
+    FROM generate_series(0, $2::int) blkno,
+    LATERAL get_raw_page($1::oid::regclass::text, blkno::int) raw,
+    LATERAL page_header(raw) h
+    WHERE h.upper <> 0 OFFSET 0) p,
+LATERAL gist_page_opaque_info(p.raw) o`, index.Oid, index.GetNumbBuffers()-1)
+	if err != nil {
+		return eris.Wrap(err, "Fetch GiST pages failed")
+	}
+	responses, err := pgx.CollectRows(rows, pgx.RowToStructByPos[gistPageResponse])
+	if err != nil {
+		return eris.Wrap(err, "Error collecting GiST pages")
+	}
+
+	index.IndexPages = make([]model.IndexPage, index.GetNumbBuffers())
+	for i := range index.IndexPages {
+		index.IndexPages[i] = model.IndexPage{Type: model.PageTypeUnused, Next: -1}
+	}
+	livePages := make([]int, 0)
+	for _, r := range responses {
+		if r.Block >= len(index.IndexPages) {
+			continue
+		}
+		page := model.IndexPage{
+			Type:     model.GetGistPageType(r.Flags),
+			FreeSize: r.FreeSize,
+			Next:     -1,
+			Flags:    r.Flags,
+		}
+		if r.Nsn != "0/0" {
+			page.Flags = append(page.Flags, "nsn "+r.Nsn)
+		}
+		if slices.Contains(r.Flags, "follow_right") && r.RightLink != invalidBlockNumber {
+			page.Next = int(r.RightLink)
+		}
+		if page.Type != model.PageTypeDeleted {
+			livePages = append(livePages, r.Block)
+		}
+		index.IndexPages[r.Block] = page
+	}
+
+	rows, err = d.Query(ctx, `SELECT blkno, (count(*) FILTER (WHERE NOT i.dead))::int, (count(*) FILTER (WHERE i.dead))::int
+FROM unnest($2::int[]) blkno,
+LATERAL gist_page_items_bytea(get_raw_page($1::oid::regclass::text, blkno)) i
+GROUP BY blkno`, index.Oid, livePages)
+	if err != nil {
+		return eris.Wrap(err, "Fetch GiST items failed")
+	}
+	counts, err := pgx.CollectRows(rows, pgx.RowToStructByPos[itemCountResponse])
+	if err != nil {
+		return eris.Wrap(err, "Error collecting GiST items")
+	}
+	for _, c := range counts {
+		index.IndexPages[c.Block].LiveItems = c.LiveItems
+		index.IndexPages[c.Block].DeadItems = c.DeadItems
+	}
+	index.Summary = model.GetPageTypeSummary(index.IndexPages)
+	return nil
+}
+
+// FetchSpgistPages fills the page types of a SP-GiST index. pageinspect
+// has no SP-GiST support, the special space is read from the raw pages.
+// New zeroed pages have no special space and are unused.
+func (d *DbPool) FetchSpgistPages(ctx context.Context, index *model.Relation) error {
+	logrus.Debugf("Fetch SP-GiST pages of index '%s'", index.Name)
+	rows, err := d.Query(ctx, `SELECT blkno::int, substring(raw FROM h.special + 1 FOR $3::int),
+    greatest(h.lower - $4::int, 0)::int / $5::int, (h.upper - h.lower)::int
+FROM generate_series(0, $2::int) blkno,
+LATERAL get_raw_page($1::oid::regclass::text, blkno::int) raw,
+LATERAL page_header(raw) h
+WHERE h.upper <> 0`, index.Oid, index.GetNumbBuffers()-1,
+		model.SpgistSpecialSize, model.PageHeaderSize, model.ItemIdSize)
+	if err != nil {
+		return eris.Wrap(err, "Fetch SP-GiST pages failed")
+	}
+	responses, err := pgx.CollectRows(rows, pgx.RowToStructByPos[spgistPageResponse])
+	if err != nil {
+		return eris.Wrap(err, "Error collecting SP-GiST pages")
+	}
+
+	index.IndexPages = make([]model.IndexPage, index.GetNumbBuffers())
+	for i := range index.IndexPages {
+		index.IndexPages[i] = model.IndexPage{Type: model.PageTypeUnused, Next: -1}
+	}
+	for _, r := range responses {
+		if r.Block >= len(index.IndexPages) {
+			continue
+		}
+		index.IndexPages[r.Block], err = model.NewSpgistPage(r.Special, r.NumItems, r.FreeSize)
+		if err != nil {
+			return eris.Wrapf(err, "Error decoding SP-GiST page %d", r.Block)
+		}
+	}
+	index.Summary = model.GetPageTypeSummary(index.IndexPages)
+	return nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/rotisserie/eris"
+	"github.com/sirupsen/logrus"
+)
+
+type hashPageTypeResponse struct {
+	Block int
+	Type  string
+}
+
+type hashPageStatsResponse struct {
+	Block     int
+	LiveItems int
+	DeadItems int
+	FreeSize  int
+	NextBlock int64
+	Flag      int
+}
+
+// FetchHashMeta fetches the metapage of a hash index
+func (d *DbPool) FetchHashMeta(ctx context.Context, index model.Relation) (model.HashMeta, error) {
+	rows, err := d.Query(ctx, `SELECT ntuples::bigint, ffactor::int, maxbucket::int
+FROM hash_metapage_info(get_raw_page($1::oid::regclass::text, 0))`, index.Oid)
+	if err != nil {
+		return model.HashMeta{}, eris.Wrap(err, "Fetch hash metapage failed")
+	}
+	meta, err := pgx.CollectOneRow(rows, pgx.RowToStructByPos[model.HashMeta])
+	if err != nil {
+		return meta, eris.Wrap(err, "Error collecting hash metapage")
+	}
+	return meta, nil
+}
+
+// FetchHashPages fills the page types of a hash index with the overflow
+// chain of each bucket
+func (d *DbPool) FetchHashPages(ctx context.Context, index *model.Relation) error {
+	logrus.Debugf("Fetch hash pages of index '%s'", index.Name)
+	meta, err := d.FetchHashMeta(ctx, *index)
+	if err != nil {
+		return err
+	}
+	rows, err := d.Query(ctx, `SELECT blkno::int, hash_page_type(get_raw_page($1::oid::regclass::text, blkno::int))
+FROM generate_series(0, $2::int) blkno`, index.Oid, index.GetNumbBuffers()-1)
+	if err != nil {
+		return eris.Wrap(err, "Fetch hash page types failed")
+	}
+	types, err := pgx.CollectRows(rows, pgx.RowToStructByPos[hashPageTypeResponse])
+	if err != nil {
+		return eris.Wrap(err, "Error collecting hash page types")
+	}
+
+	index.IndexPages = make([]model.IndexPage, index.GetNumbBuffers())
+	// hash_page_stats fails on metapage, bitmap and unused pages
+	itemPages := make([]int, 0)
+	for _, t := range types {
+		if t.Block >= len(index.IndexPages) {
+			continue
+		}
+		index.IndexPages[t.Block] = model.IndexPage{Type: model.GetHashPageType(t.Type), Next: -1}
+		if t.Type == "bucket" || t.Type == "overflow" {
+			itemPages = append(itemPages, t.Block)
+		}
+	}
+
+	rows, err = d.Query(ctx, `SELECT blkno, s.live_items::int, s.dead_items::int, s.free_size::int,
+    s.hasho_nextblkno::bigint, s.hasho_flag::int
+FROM unnest($2::int[]) blkno,
+LATERAL hash_page_stats(get_raw_page($1::oid::regclass::text, blkno)) s`, index.Oid, itemPages)
+	if err != nil {
+		return eris.Wrap(err, "Fetch hash page stats failed")
+	}
+	stats, err := pgx.CollectRows(rows, pgx.RowToStructByPos[hashPageStatsResponse])
+	if err != nil {
+		return eris.Wrap(err, "Error collecting hash page stats")
+	}
+	for _, s := range stats {
+		page := &index.IndexPages[s.Block]
+		page.LiveItems = s.LiveItems
+		page.DeadItems = s.DeadItems
+		page.FreeSize = s.FreeSize
+		page.Flags = model.GetHashPageFlags(s.Flag)
+		if s.NextBlock != invalidBlockNumber {
+			page.Next = int(s.NextBlock)
+		}
+	}
+	index.Summary = model.GetHashSummary(meta, index.IndexPages)
+	return nil
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/rotisserie/eris"
+	"github.com/sirupsen/logrus"
+)
+
+type blockCount struct {
+	Block int
+	Count int
+}
+
+// beginUserQuery starts the read only transaction running a user provided
+// query, bounded by the user query timeout
+func (d *DbPool) beginUserQuery(ctx context.Context) (pgx.Tx, error) {
+	tx, err := d.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, eris.Wrap(err, "Error starting read only transaction")
+	}
+	if d.UserQueryTimeout > 0 {
+		_, err = tx.Exec(ctx, "SELECT set_config('statement_timeout', $1, true)",
+			fmt.Sprintf("%dms", d.UserQueryTimeout.Milliseconds()))
+		if err != nil {
+			tx.Rollback(ctx)
+			return nil, eris.Wrap(err, "Error setting statement_timeout")
+		}
+	}
+	return tx, nil
+}
+
+// FetchRowsPerBlock runs a user query returning a ctid column in a read
+// only transaction and counts the returned rows per block
+func (d *DbPool) FetchRowsPerBlock(ctx context.Context, query string, numBlocks int) ([]int, error) {
+	logrus.Debugf("Locate rows of query '%s'", query)
+	tx, err := d.beginUserQuery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	rows, err := tx.Query(ctx, `SELECT (q.ctid::text::point)[0]::bigint, count(*)
+FROM (`+query+`) q GROUP BY 1`)
+	if err != nil {
+		return nil, eris.Wrap(err, "Locate query failed, it needs to return a ctid column")
+	}
+	counts, err := pgx.CollectRows(rows, pgx.RowToStructByPos[blockCount])
+	if err != nil {
+		return nil, eris.Wrap(err, "Error collecting located rows")
+	}
+	rowsPerBlock := make([]int, numBlocks)
+	for _, c := range counts {
+		if c.Block < numBlocks {
+			rowsPerBlock[c.Block] = c.Count
+		}
+	}
+	return rowsPerBlock, nil
+}
+
+// HighlightQueryRows highlights the table's blocks holding rows returned by the query
+func (d *DbPool) HighlightQueryRows(ctx context.Context, table *model.Table, query string) (err error) {
+	table.Highlight, err = d.FetchRowsPerBlock(ctx, query, table.GetNumbBuffers())
+	table.HighlightLabel = "Matching rows"
+	return err
+}
+
+// ExecReadOnly runs a user query in a read only transaction, discarding its result
+func (d *DbPool) ExecReadOnly(ctx context.Context, query string) error {
+	logrus.Debugf("Run query '%s'", query)
+	tx, err := d.beginUserQuery(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, query)
+	if err != nil {
+		return eris.Wrap(err, "Query failed")
+	}
+	for rows.Next() {
+		// Only the buffers loaded by the query matter
+	}
+	if rows.Err() != nil {
+		return eris.Wrap(rows.Err(), "Error reading query result")
+	}
+	return nil
+}
+
+// TraceQuery highlights the blocks of the table, indexes and toast loaded
+// in shared buffers while running the query. Buffers are snapshotted
+// before and after the query so blocks loaded by concurrent activity will
+// also show up, and blocks already cached won't.
+func (d *DbPool) TraceQuery(ctx context.Context, table *model.Table, query string) error {
+	installed, err := d.HasExtension(ctx, "pg_buffercache")
+	if err != nil {
+		return err
+	}
+	if !installed {
+		return eris.New("Extension pg_buffercache is required to trace a query")
+	}
+
+	relations := table.GetRelations()
+	before := make([][]bool, len(relations))
+	for i, r := range relations {
+		before[i], err = d.FetchCached(ctx, r.Oid, r.GetNumbBuffers())
+		if err != nil {
+			return err
+		}
+	}
+
+	err = d.ExecReadOnly(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	for i, r := range relations {
+		r.Cached, err = d.FetchCached(ctx, r.Oid, r.GetNumbBuffers())
+		if err != nil {
+			return err
+		}
+		r.Highlight = make([]int, r.GetNumbBuffers())
+		for block, cached := range r.Cached {
+			if cached && !before[i][block] {
+				r.Highlight[block] = 1
+			}
+		}
+	}
+	table.HighlightLabel = "Loaded by query"
+	return nil
+}
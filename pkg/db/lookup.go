@@ -0,0 +1,239 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/rotisserie/eris"
+	"github.com/sirupsen/logrus"
+)
+
+type indexKeyResponse struct {
+	Expression string
+	KeyType    string
+	TypeName   string
+	Collation  string
+	NumAtts    int
+	Desc       bool
+	NullsFirst bool
+	TableName  string
+}
+
+// fetchIndexKey fetches the expression, type and ordering of the first
+// column of an index
+func (d *DbPool) fetchIndexKey(ctx context.Context, table model.Table, index model.Relation) (indexKeyResponse, error) {
+	rows, err := d.Query(ctx, `SELECT pg_get_indexdef(i.indexrelid, 1, true), format_type(a.atttypid, a.atttypmod),
+    t.typname::text, coalesce((SELECT format('COLLATE %I.%I', n.nspname, c.collname)
+        FROM pg_collation c JOIN pg_namespace n ON n.oid = c.collnamespace
+        WHERE c.oid = i.indcollation[0]), ''),
+    i.indnatts::int, (i.indoption[0] & 1) <> 0, (i.indoption[0] & 2) <> 0, $2::oid::regclass::text
+FROM pg_index i
+JOIN pg_attribute a ON a.attrelid = i.indexrelid AND a.attnum = 1
+JOIN pg_type t ON t.oid = a.atttypid
+WHERE i.indexrelid = $1`, index.Oid, table.Oid)
+	if err != nil {
+		return indexKeyResponse{}, eris.Wrap(err, "Fetch index key failed")
+	}
+	indexKey, err := pgx.CollectOneRow(rows, pgx.RowToStructByPos[indexKeyResponse])
+	if err != nil {
+		return indexKey, eris.Wrap(err, "Error collecting index key")
+	}
+	return indexKey, nil
+}
+
+// fetchMatchingRows returns the block of each visible row of the table
+// whose index key is equal to the key value. Only the index's first column
+// is compared.
+func (d *DbPool) fetchMatchingRows(ctx context.Context, indexKey indexKeyResponse, key string) ([]int, error) {
+	tx, err := d.beginUserQuery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	query := fmt.Sprintf("SELECT (ctid::text::point)[0]::int FROM %s WHERE (%s) = $1::%s",
+		indexKey.TableName, indexKey.Expression, indexKey.KeyType)
+	logrus.Debugf("Fetch rows matching key with '%s'", query)
+	rows, err := tx.Query(ctx, query, key)
+	if err != nil {
+		return nil, eris.Wrapf(err, "Fetch rows matching key '%s' failed", key)
+	}
+	matchingRows, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, eris.Wrap(err, "Error collecting rows matching key")
+	}
+	return matchingRows, nil
+}
+
+// fetchLookupPage reads a btree page and its items
+func (d *DbPool) fetchLookupPage(ctx context.Context, index model.Relation, block int) (model.BtreeLookupPage, error) {
+	batch := &pgx.Batch{}
+	batch.Queue(`SELECT $2::int, type::text, live_items, dead_items, free_size,
+    btpo_prev::bigint, btpo_next::bigint, btpo_level::int, btpo_flags
+FROM bt_page_stats($1::oid::regclass::text, $2::int)`, index.Oid, block)
+	batch.Queue(`SELECT itemoffset::int, (ctid::text::point)[0]::int, coalesce(nulls, false),
+    coalesce(data, ''), coalesce(cardinality(tids), 1)
+FROM bt_page_items($1::oid::regclass::text, $2::int)
+ORDER BY itemoffset`, index.Oid, block)
+	results := d.SendBatch(ctx, batch)
+	defer results.Close()
+
+	page := model.BtreeLookupPage{}
+	rows, err := results.Query()
+	if err != nil {
+		return page, eris.Wrapf(err, "Fetch stats of page %d failed", block)
+	}
+	page.BtreePage, err = pgx.CollectOneRow(rows, pgx.RowToStructByPos[model.BtreePage])
+	if err != nil {
+		return page, eris.Wrapf(err, "Error collecting stats of page %d", block)
+	}
+	rows, err = results.Query()
+	if err != nil {
+		return page, eris.Wrapf(err, "Fetch items of page %d failed", block)
+	}
+	page.Items, err = pgx.CollectRows(rows, pgx.RowToStructByPos[model.BtreeItem])
+	if err != nil {
+		return page, eris.Wrapf(err, "Error collecting items of page %d", block)
+	}
+	return page, nil
+}
+
+// compareItems compares the items of a page with the key in index order.
+// The first data item of an internal page is minus infinity.
+func (d *DbPool) compareItems(ctx context.Context, indexKey indexKeyResponse, page *model.BtreeLookupPage, key string) error {
+	page.Cmps = make([]int, len(page.Items))
+	literals := make([]string, 0, len(page.Items))
+	positions := make([]int, 0, len(page.Items))
+	for i, item := range page.Items {
+		switch {
+		case !page.IsLeaf() && item.Offset == page.GetFirstDataItem():
+			page.Cmps[i] = -1
+		case item.Nulls && indexKey.NumAtts > 1:
+			return eris.Errorf("Item %d of page %d has null columns, its key can't be decoded", item.Offset, page.Block)
+		case item.Nulls && indexKey.NullsFirst:
+			page.Cmps[i] = -1
+		case item.Nulls:
+			page.Cmps[i] = 1
+		default:
+			literal, err := item.DecodeFirstKey(indexKey.TypeName)
+			if err != nil {
+				return err
+			}
+			literals = append(literals, literal)
+			positions = append(positions, i)
+		}
+	}
+	if len(literals) == 0 {
+		return nil
+	}
+	query := fmt.Sprintf(`SELECT CASE WHEN v::%[1]s %[2]s < $1::%[1]s THEN -1 WHEN v::%[1]s %[2]s = $1::%[1]s THEN 0 ELSE 1 END
+FROM unnest($2::text[]) WITH ORDINALITY AS u(v, n) ORDER BY n`, indexKey.KeyType, indexKey.Collation)
+	rows, err := d.Query(ctx, query, key, literals)
+	if err != nil {
+		return eris.Wrapf(err, "Compare items of page %d with key '%s' failed", page.Block, key)
+	}
+	cmps, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return eris.Wrapf(err, "Error collecting comparisons of page %d", page.Block)
+	}
+	for i, cmp := range cmps {
+		if indexKey.Desc {
+			cmp = -cmp
+		}
+		page.Cmps[positions[i]] = cmp
+	}
+	return nil
+}
+
+// readLookupPage reads a page and compares its items with the key
+func (d *DbPool) readLookupPage(ctx context.Context, index model.Relation, indexKey indexKeyResponse, block int, key string) (model.BtreeLookupPage, error) {
+	page, err := d.fetchLookupPage(ctx, index, block)
+	if err != nil {
+		return page, err
+	}
+	err = d.compareItems(ctx, indexKey, &page, key)
+	return page, err
+}
+
+// descendBtree follows the path of _bt_search from the fast root to the
+// leaves, then scans the leaves on the right while they can hold the key
+func (d *DbPool) descendBtree(ctx context.Context, index model.Relation, indexKey indexKeyResponse, key string) (model.KeyLookup, error) {
+	lookup := model.NewKeyLookup(index.Name, key)
+	meta, err := d.FetchBtreeMeta(ctx, index)
+	if err != nil {
+		return lookup, err
+	}
+	block := meta.FastRoot
+	if block == 0 {
+		block = meta.Root
+	}
+	// Bound the number of pages read in case of a corrupted sibling chain
+	for maxPages := index.GetNumbBuffers(); block != 0 && len(lookup.Path) < maxPages; {
+		page, err := d.readLookupPage(ctx, index, indexKey, block, key)
+		if err != nil {
+			return lookup, err
+		}
+		lookup.AddPage(page)
+		switch {
+		case page.IsDeleted() || page.MustMoveRight():
+			block = page.Next
+		case !page.IsLeaf():
+			block, err = page.GetDownlink()
+			if err != nil {
+				return lookup, err
+			}
+		case page.EndsScan():
+			block = 0
+		default:
+			block = page.Next
+		}
+	}
+	return lookup, nil
+}
+
+// TraceKeyLookup highlights the pages of a btree index read when looking up
+// a key, from the root to the leaves, and the heap blocks holding the
+// matching visible rows
+func (d *DbPool) TraceKeyLookup(ctx context.Context, table *model.Table, indexName string, key string) error {
+	var index *model.Relation
+	for i := range table.Indexes {
+		if table.Indexes[i].Name == indexName {
+			index = &table.Indexes[i]
+		}
+	}
+	if index == nil {
+		return eris.Errorf("Index '%s' not found on table '%s'", indexName, table.Name)
+	}
+	if index.AccessMethod != "btree" {
+		return eris.Errorf("Index '%s' is a %s index, only btree indexes can be traced", indexName, index.AccessMethod)
+	}
+	err := d.requirePageinspect(ctx)
+	if err != nil {
+		return err
+	}
+
+	indexKey, err := d.fetchIndexKey(ctx, *table, *index)
+	if err != nil {
+		return err
+	}
+	lookup, err := d.descendBtree(ctx, *index, indexKey, key)
+	if err != nil {
+		return err
+	}
+	matchingRows, err := d.fetchMatchingRows(ctx, indexKey, key)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Lookup of key '%s' in %s reads pages %v, %d matching rows", key, index.Name, lookup.Path, len(matchingRows))
+
+	index.Highlight = lookup.GetHighlight(index.GetNumbBuffers())
+	table.Highlight = make([]int, table.GetNumbBuffers())
+	for _, block := range matchingRows {
+		if block < len(table.Highlight) {
+			table.Highlight[block]++
+		}
+	}
+	table.HighlightLabel = fmt.Sprintf("Lookup of '%s' in %s", key, index.Name)
+	return nil
+}
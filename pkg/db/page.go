@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/rotisserie/eris"
+	"github.com/sirupsen/logrus"
+)
+
+// IsHeap returns whether the relation stores heap pages
+func (d *DbPool) IsHeap(ctx context.Context, relationName string) (bool, error) {
+	var relkind string
+	err := d.QueryRow(ctx, "SELECT relkind::text FROM pg_class WHERE oid = $1::regclass", relationName).Scan(&relkind)
+	if err != nil {
+		return false, eris.Wrapf(err, "Error fetching kind of relation '%s'", relationName)
+	}
+	return relkind == "r" || relkind == "t" || relkind == "m", nil
+}
+
+func (d *DbPool) FetchPageHeader(ctx context.Context, relationName string, block int) (model.PageHeader, error) {
+	logrus.Debugf("Fetch page header of block %d of relation '%s'", block, relationName)
+	rows, err := d.Query(ctx, `SELECT lsn::text, checksum, flags, lower, upper, special, pagesize, version,
+    prune_xid::text::bigint
+FROM page_header(get_raw_page($1, $2))`, relationName, block)
+	if err != nil {
+		return model.PageHeader{}, eris.Wrap(err, "Fetch page header failed")
+	}
+	header, err := pgx.CollectOneRow(rows, pgx.RowToStructByPos[model.PageHeader])
+	if err != nil {
+		return header, eris.Wrap(err, "Error collecting page header")
+	}
+	return header, nil
+}
+
+func (d *DbPool) FetchHeapPageItems(ctx context.Context, relationName string, block int) ([]model.HeapItem, error) {
+	logrus.Debugf("Fetch items of block %d of relation '%s'", block, relationName)
+	rows, err := d.Query(ctx, `SELECT lp, lp_off, lp_flags, lp_len,
+    t_xmin IS NOT NULL,
+    coalesce(t_xmin::text::bigint, 0),
+    coalesce(t_xmax::text::bigint, 0),
+    coalesce((t_ctid::text::point)[0]::bigint, 0),
+    coalesce((t_ctid::text::point)[1]::int, 0),
+    coalesce(t_infomask2, 0),
+    coalesce(t_infomask, 0),
+    coalesce(t_hoff, 0),
+    coalesce(t_bits, '')
+FROM heap_page_items(get_raw_page($1, $2))`, relationName, block)
+	if err != nil {
+		return nil, eris.Wrap(err, "Fetch heap page items failed")
+	}
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByPos[model.HeapItem])
+	if err != nil {
+		return nil, eris.Wrap(err, "Error collecting heap page items")
+	}
+	return items, nil
+}
+
+// FetchRawPage returns the content of a block using pageinspect
+func (d *DbPool) FetchRawPage(ctx context.Context, relationName string, block int) ([]byte, error) {
+	logrus.Debugf("Fetch raw page of block %d of relation '%s'", block, relationName)
+	var raw []byte
+	err := d.QueryRow(ctx, "SELECT get_raw_page($1, $2)", relationName, block).Scan(&raw)
+	if err != nil {
+		return nil, eris.Wrap(err, "Fetch raw page failed")
+	}
+	return raw, nil
+}
+
+// FetchPage fetches a block's header and items using pageinspect
+func (d *DbPool) FetchPage(ctx context.Context, relationName string, block int) (page model.Page, err error) {
+	page.Relation = relationName
+	page.Block = block
+	installed, err := d.HasExtension(ctx, "pageinspect")
+	if err != nil {
+		return
+	}
+	if !installed {
+		err = eris.New("Extension pageinspect is required to inspect a page")
+		return
+	}
+	page.Header, err = d.FetchPageHeader(ctx, relationName, block)
+	if err != nil {
+		return
+	}
+	isHeap, err := d.IsHeap(ctx, relationName)
+	if err != nil || !isHeap {
+		return
+	}
+	page.Items, err = d.FetchHeapPageItems(ctx, relationName, block)
+	return
+}
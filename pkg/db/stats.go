@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/rotisserie/eris"
+	"github.com/sirupsen/logrus"
+)
+
+// FetchTupleStats runs pgstattuple on a heap, or pgstattuple_approx when
+// the heap has more than ExactStatsMaxBlocks blocks
+func (d *DbPool) FetchTupleStats(ctx context.Context, relation model.Relation) (*model.TupleStats, error) {
+	var numBlocks int
+	err := d.QueryRow(ctx, "SELECT (pg_relation_size($1) / current_setting('block_size')::int)::int",
+		relation.Oid).Scan(&numBlocks)
+	if err != nil {
+		return nil, eris.Wrapf(err, "Fetch size of relation '%s' failed", relation.Name)
+	}
+	query := `SELECT false, table_len, tuple_count, tuple_len, tuple_percent,
+    dead_tuple_count, dead_tuple_len, dead_tuple_percent, free_space, free_percent
+FROM pgstattuple($1::oid::regclass)`
+	if numBlocks > d.ExactStatsMaxBlocks {
+		query = `SELECT true, table_len, approx_tuple_count, approx_tuple_len, approx_tuple_percent,
+    dead_tuple_count, dead_tuple_len, dead_tuple_percent, approx_free_space, approx_free_percent
+FROM pgstattuple_approx($1::oid::regclass)`
+	}
+	logrus.Debugf("Fetch tuple stats of relation '%s'", relation.Name)
+	rows, err := d.Query(ctx, query, relation.Oid)
+	if err != nil {
+		return nil, eris.Wrap(err, "Fetch tuple stats failed")
+	}
+	stats, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByPos[model.TupleStats])
+	if err != nil {
+		return nil, eris.Wrap(err, "Error collecting tuple stats")
+	}
+	return stats, nil
+}
+
+// FetchIndexStats runs pgstatindex on a btree index
+func (d *DbPool) FetchIndexStats(ctx context.Context, index model.Relation) (*model.IndexStats, error) {
+	logrus.Debugf("Fetch index stats of index '%s'", index.Name)
+	rows, err := d.Query(ctx, `SELECT tree_level, index_size, internal_pages, leaf_pages, empty_pages,
+    deleted_pages, avg_leaf_density, leaf_fragmentation
+FROM pgstatindex($1::oid::regclass)`, index.Oid)
+	if err != nil {
+		return nil, eris.Wrap(err, "Fetch index stats failed")
+	}
+	stats, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByPos[model.IndexStats])
+	if err != nil {
+		return nil, eris.Wrap(err, "Error collecting index stats")
+	}
+	return stats, nil
+}
+
+// FetchStats fills the statistics of the table's heap, toast and btree
+// indexes. Only the relations' oids are needed.
+func (d *DbPool) FetchStats(ctx context.Context, table *model.Table) error {
+	installed, err := d.HasExtension(ctx, "pgstattuple")
+	if err != nil {
+		return err
+	}
+	if !installed {
+		return eris.New("Extension pgstattuple is required to fetch statistics")
+	}
+	return d.fetchRelationStats(ctx, table)
+}
+
+// fetchRelationStats fills the statistics, pgstattuple being installed
+func (d *DbPool) fetchRelationStats(ctx context.Context, table *model.Table) error {
+	var err error
+	heaps := []*model.Relation{&table.Relation}
+	indexes := make([]*model.Relation, 0)
+	for i := range table.Indexes {
+		indexes = append(indexes, &table.Indexes[i])
+	}
+	if table.Toast != nil {
+		heaps = append(heaps, &table.Toast.Relation)
+		indexes = append(indexes, &table.Toast.Index)
+	}
+	for _, heap := range heaps {
+		heap.TupleStats, err = d.FetchTupleStats(ctx, *heap)
+		if err != nil {
+			return err
+		}
+	}
+	for _, index := range indexes {
+		if index.AccessMethod != "btree" {
+			continue
+		}
+		index.IndexStats, err = d.FetchIndexStats(ctx, *index)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchStats fetches the statistics when enabled and pgstattuple is available
+func (d *DbPool) fetchStats(ctx context.Context, table *model.Table) error {
+	if !d.Stats {
+		return nil
+	}
+	installed, err := d.checkExtension(ctx, "pgstattuple")
+	if err != nil || !installed {
+		return err
+	}
+	return d.fetchRelationStats(ctx, table)
+}
@@ -12,12 +12,15 @@ type HttpServerConfigCli struct {
 	HttpProfAddress string
 	Timeout         time.Duration
 	Debug           bool
+	// Run queries passed by the highlight and trace parameters
+	AllowUserQueries bool
 }
 
 func SetHttpServerConfigFlags(fs *pflag.FlagSet) {
 	fs.String("listen-address", "localhost:8080", "Listen address of the http server")
 	fs.String("http-prof-address", "localhost:6060", "Listen address of the pprof endpoint")
 	fs.Bool("http-debug", false, "Activate debug mode of the http server")
+	fs.Bool("allow-user-queries", false, "Run the read only SQL queries passed by the highlight and trace parameters. Anyone reaching the server can then run queries with its credentials")
 }
 
 func GetHttpServerConfigCli() HttpServerConfigCli {
@@ -25,6 +28,7 @@ func GetHttpServerConfigCli() HttpServerConfigCli {
 	h.ListenAddress = viper.GetString("listen-address")
 	h.HttpProfAddress = viper.GetString("http-prof-address")
 	h.Debug = viper.GetBool("http-debug")
+	h.AllowUserQueries = viper.GetBool("allow-user-queries")
 	h.Timeout = viper.GetDuration("timeout")
 	return h
 }
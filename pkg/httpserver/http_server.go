@@ -6,8 +6,11 @@ import (
 	"net/http"
 	"time"
 
+	svg "github.com/ajstarks/svgo"
 	"github.com/bonnefoa/pg_buffer_viz/pkg/bufferviz"
 	"github.com/bonnefoa/pg_buffer_viz/pkg/db"
+	"github.com/bonnefoa/pg_buffer_viz/pkg/layout"
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
 	"github.com/bonnefoa/pg_buffer_viz/pkg/util"
 	"github.com/gin-gonic/gin"
 	"github.com/rotisserie/eris"
@@ -15,26 +18,50 @@ import (
 )
 
 type HttpServer struct {
-	db        *db.DbPool
-	bufferViz *bufferviz.BufferViz
+	db *db.DbPool
+	// Drawing configuration, a BufferViz is built for each request as it
+	// holds the state of the drawn table
+	blockSize  model.Size
+	marginSize model.Size
+	maxCells   int
+	layout     layout.Layout
+
+	// Whether SQL from the highlight and trace parameters can be run
+	allowUserQueries bool
 }
 
-func newHttpServer(ctx context.Context) (*HttpServer, error) {
+func newHttpServer(ctx context.Context, h *HttpServerConfigCli) (*HttpServer, error) {
 	dbConfig := db.GetDbConfigCli()
 	dbConnection, err := db.NewDbPool(ctx, dbConfig.ConnectUrl)
 	if err != nil {
 		return nil, err
 	}
-	b := bufferviz.NewBufferViz(
-		nil,
-		util.GetBlockSize(),
-		util.GetMarginSize(),
-	)
+	dbConnection.FetchOptions = dbConfig.FetchOptions
+	dbConnection.UserQueryTimeout = dbConfig.UserQueryTimeout
+	server := &HttpServer{
+		db:         dbConnection,
+		blockSize:  util.GetBlockSize(),
+		marginSize: util.GetMarginSize(),
+		maxCells:   util.GetMaxCells(),
 
-	server := &HttpServer{bufferViz: &b, db: dbConnection}
+		allowUserQueries: h.AllowUserQueries,
+	}
+	server.layout, err = layout.GetLayout(util.GetLayoutName())
+	if err != nil {
+		return nil, err
+	}
 	return server, nil
 }
 
+// newBufferViz returns a BufferViz drawing on the canvas with the server's
+// configuration
+func (s *HttpServer) newBufferViz(canvas *svg.SVG) *bufferviz.BufferViz {
+	b := bufferviz.NewBufferViz(canvas, s.blockSize, s.marginSize)
+	b.MaxCells = s.maxCells
+	b.Layout = s.layout
+	return &b
+}
+
 func startHttpServer(ctx context.Context, listener net.Listener, srv *http.Server) {
 	go func() {
 		logrus.Infof("Starting http server on %s", srv.Addr)
@@ -65,7 +92,7 @@ func StartHttpServer(ctx context.Context, h *HttpServerConfigCli) (*HttpServer,
 	if err != nil {
 		return nil, eris.Wrapf(err, "Failed to listen on %s", h.ListenAddress)
 	}
-	server, err := newHttpServer(ctx)
+	server, err := newHttpServer(ctx, h)
 	if err != nil {
 		return nil, err
 	}
@@ -1,8 +1,13 @@
 package httpserver
 
 import (
+	"bytes"
+	"html/template"
 	"net/http"
+	"strconv"
 
+	"github.com/bonnefoa/pg_buffer_viz/pkg/bufferviz"
+	"github.com/bonnefoa/pg_buffer_viz/pkg/page"
 	"github.com/bonnefoa/pg_buffer_viz/pkg/render"
 	"github.com/gin-gonic/gin"
 	"github.com/rotisserie/eris"
@@ -20,22 +25,246 @@ func (s *HttpServer) statsRoute(c *gin.Context) {
 }
 
 func (s *HttpServer) renderTable(c *gin.Context) {
+	logrus.Info(c.Params)
+	tableName := c.Params.ByName("table")
+	if (c.Query("highlight") != "" || c.Query("trace") != "") && !s.allowUserQueries {
+		c.AbortWithError(http.StatusForbidden, eris.New("User queries are disabled, start the server with --allow-user-queries"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	table, err := s.db.FetchTable(ctx, tableName)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if highlightQuery := c.Query("highlight"); highlightQuery != "" {
+		err = s.db.HighlightQueryRows(ctx, &table, highlightQuery)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if traceQuery := c.Query("trace"); traceQuery != "" {
+		err = s.db.TraceQuery(ctx, &table, traceQuery)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if c.Query("stats") != "" && !s.db.Stats {
+		err = s.db.FetchStats(ctx, &table)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if lookupIndex := c.Query("lookup_index"); lookupIndex != "" {
+		err = s.db.TraceKeyLookup(ctx, &table, lookupIndex, c.Query("lookup_key"))
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if insertSize := c.Query("insert_size"); insertSize != "" {
+		tupleSize, err := strconv.Atoi(insertSize)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, eris.Wrap(err, "Invalid tuple size"))
+			return
+		}
+		// The table's fillfactor is used unless one is given
+		fillfactor := 0
+		if insertFillfactor := c.Query("insert_fillfactor"); insertFillfactor != "" {
+			fillfactor, err = strconv.Atoi(insertFillfactor)
+			if err != nil {
+				c.AbortWithError(http.StatusBadRequest, eris.Wrap(err, "Invalid fillfactor"))
+				return
+			}
+		}
+		_, err = s.db.HighlightInserts(ctx, &table, tupleSize, fillfactor)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+	}
+	brinIndex := c.Query("brin")
+	if brinIndex != "" && table.GetBrin(brinIndex) == nil {
+		c.AbortWithError(http.StatusBadRequest, eris.Errorf("No BRIN ranges fetched for index '%s'", brinIndex))
+		return
+	}
+	c.Header("Content-Type", "image/svg+xml")
 	canvas := render.NewCanvasIo(c.Writer)
-	s.bufferViz.SetCanvas(canvas.SVG)
+	b := s.newBufferViz(canvas.SVG)
+	b.BrinIndex = brinIndex
+	b.ShowBloat = c.Query("bloat") != ""
+	b.ShowRecommendations = c.Query("recommend") != ""
+	b.DrawTable(table)
+	b.AddFooter()
+	canvas.End()
+}
 
-	logrus.Info(c.Params)
+func (s *HttpServer) renderCorrelation(c *gin.Context) {
 	tableName := c.Params.ByName("table")
+	ctx := c.Request.Context()
+	table, err := s.db.FetchTable(ctx, tableName)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	correlations, err := s.db.FetchCorrelations(ctx, table)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Header("Content-Type", "image/svg+xml")
+	canvas := render.NewCanvasIo(c.Writer)
+	bufferviz.DrawCorrelations(canvas.SVG, table, correlations)
+	canvas.End()
+}
 
+func (s *HttpServer) renderBtree(c *gin.Context) {
+	tableName := c.Params.ByName("table")
 	ctx := c.Request.Context()
 	table, err := s.db.FetchTable(ctx, tableName)
 	if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
-	s.bufferViz.DrawTable(table)
-	s.bufferViz.AddFooter()
+	trees, err := s.db.FetchBtreeTrees(ctx, table)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Header("Content-Type", "image/svg+xml")
+	canvas := render.NewCanvasIo(c.Writer)
+	bufferviz.DrawBtreeTrees(canvas.SVG, table, trees)
 	canvas.End()
+}
+
+// tableStatsRoute returns the pgstattuple and pgstatindex statistics of
+// the table's relations
+func (s *HttpServer) tableStatsRoute(c *gin.Context) {
+	tableName := c.Params.ByName("table")
+	ctx := c.Request.Context()
+	table, err := s.db.FetchTableRelations(ctx, tableName)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	err = s.db.FetchStats(ctx, &table)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, table.GetStats())
+}
+
+// tableBloatRoute returns the estimated reclaimable space of the table's
+// relations
+func (s *HttpServer) tableBloatRoute(c *gin.Context) {
+	tableName := c.Params.ByName("table")
+	table, err := s.db.FetchTable(c.Request.Context(), tableName)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, table.GetBloat())
+}
+
+// tableRecommendRoute returns the ranked maintenance recommendations of
+// the table
+func (s *HttpServer) tableRecommendRoute(c *gin.Context) {
+	tableName := c.Params.ByName("table")
+	table, err := s.db.FetchTable(c.Request.Context(), tableName)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, table.GetRecommendations())
+}
+
+func (s *HttpServer) renderFillfactor(c *gin.Context) {
+	tableName := c.Params.ByName("table")
+	fillfactor, err := strconv.Atoi(c.DefaultQuery("fillfactor", "90"))
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, eris.Wrap(err, "Invalid fillfactor"))
+		return
+	}
+	ctx := c.Request.Context()
+	table, err := s.db.FetchTable(ctx, tableName)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	simulation, err := s.db.SimulateFillfactor(ctx, &table, fillfactor)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
 	c.Header("Content-Type", "image/svg+xml")
+	canvas := render.NewCanvasIo(c.Writer)
+	b := s.newBufferViz(canvas.SVG)
+	b.DrawFillfactorSimulation(simulation)
+	b.AddFooter()
+	canvas.End()
+}
+
+func (s *HttpServer) renderBlock(c *gin.Context) {
+	tableName := c.Params.ByName("table")
+	block, err := strconv.Atoi(c.Params.ByName("n"))
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, eris.Wrap(err, "Invalid block number"))
+		return
+	}
+
+	page, err := s.db.FetchPage(c.Request.Context(), tableName, block)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	var pageMap bytes.Buffer
+	bufferviz.DrawPage(render.NewCanvasIo(&pageMap).SVG, page)
+	var hotChains bytes.Buffer
+	bufferviz.DrawHotChains(render.NewCanvasIo(&hotChains).SVG, page)
+	c.HTML(http.StatusOK, "block.tmpl", gin.H{
+		"page":       page,
+		"pagemap":    template.HTML(pageMap.String()),
+		"hotchains":  template.HTML(hotChains.String()),
+		"hotsummary": bufferviz.GetHotSummary(page),
+	})
+}
+
+func (s *HttpServer) renderRawBlock(c *gin.Context) {
+	tableName := c.Params.ByName("table")
+	block, err := strconv.Atoi(c.Params.ByName("n"))
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, eris.Wrap(err, "Invalid block number"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	raw, err := s.db.FetchRawPage(ctx, tableName, block)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	isHeap, err := s.db.IsHeap(ctx, tableName)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	ranges, err := page.Decode(raw, isHeap)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.HTML(http.StatusOK, "rawpage.tmpl", gin.H{
+		"relation": tableName,
+		"block":    block,
+		"kinds":    page.Kinds,
+		"lines":    page.GetHexLines(raw, ranges),
+		"ranges":   ranges,
+	})
 }
 
 func (s *HttpServer) listRelations(c *gin.Context) {
@@ -45,7 +274,8 @@ func (s *HttpServer) listRelations(c *gin.Context) {
 		return
 	}
 	c.HTML(http.StatusOK, "index.tmpl", gin.H{
-		"relations": relations,
+		"relations":   relations,
+		"userQueries": s.allowUserQueries,
 	})
 }
 
@@ -80,6 +310,14 @@ func (s *HttpServer) setupRouter() *gin.Engine {
 
 	router.GET("/", s.listRelations)
 	router.GET("/buffer_viz/:table", s.renderTable)
+	router.GET("/buffer_viz/:table/correlation", s.renderCorrelation)
+	router.GET("/buffer_viz/:table/btree", s.renderBtree)
+	router.GET("/buffer_viz/:table/fillfactor", s.renderFillfactor)
+	router.GET("/buffer_viz/:table/stats", s.tableStatsRoute)
+	router.GET("/buffer_viz/:table/bloat", s.tableBloatRoute)
+	router.GET("/buffer_viz/:table/recommend", s.tableRecommendRoute)
+	router.GET("/buffer_viz/:table/block/:n", s.renderBlock)
+	router.GET("/buffer_viz/:table/block/:n/raw", s.renderRawBlock)
 
 	return router
 }
@@ -0,0 +1,56 @@
+package layout
+
+import (
+	"math"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+)
+
+// Hilbert lays cells along a Hilbert curve, keeping consecutive blocks
+// next to each other
+type Hilbert struct{}
+
+type hilbertGrid struct {
+	side int
+	size model.Size
+}
+
+func (Hilbert) GetGrid(numCells int, blocksPerCell int) Grid {
+	minSide := int(math.Ceil(math.Sqrt(float64(numCells))))
+	g := &hilbertGrid{side: 1}
+	for g.side < minSide {
+		g.side *= 2
+	}
+	// The curve may not fill the whole square, only keep the used area
+	for i := range numCells {
+		c := g.Position(i)
+		g.size.Width = max(g.size.Width, c.X+1)
+		g.size.Height = max(g.size.Height, c.Y+1)
+	}
+	return g
+}
+
+func (g *hilbertGrid) Size() model.Size {
+	return g.size
+}
+
+// Position converts a distance on the curve to a coordinate
+func (g *hilbertGrid) Position(cell int) model.Coordinate {
+	var c model.Coordinate
+	t := cell
+	for s := 1; s < g.side; s *= 2 {
+		rx := 1 & (t / 2)
+		ry := 1 & (t ^ rx)
+		if ry == 0 {
+			if rx == 1 {
+				c.X = s - 1 - c.X
+				c.Y = s - 1 - c.Y
+			}
+			c.X, c.Y = c.Y, c.X
+		}
+		c.X += s * rx
+		c.Y += s * ry
+		t /= 4
+	}
+	return c
+}
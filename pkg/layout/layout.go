@@ -0,0 +1,51 @@
+package layout
+
+import (
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/rotisserie/eris"
+)
+
+// Grid places the cells of a relation in 2D
+type Grid interface {
+	// Size returns the number of cells in width and height covered by the grid
+	Size() model.Size
+	// Position returns the coordinate of a cell relative to the grid's origin
+	Position(cell int) model.Coordinate
+}
+
+// Layout builds the grid used to draw a relation
+type Layout interface {
+	GetGrid(numCells int, blocksPerCell int) Grid
+}
+
+// GetLayout returns the layout matching the given name
+func GetLayout(name string) (Layout, error) {
+	switch name {
+	case "row":
+		return RowMajor{}, nil
+	case "hilbert":
+		return Hilbert{}, nil
+	case "segment":
+		return Segment{}, nil
+	}
+	return nil, eris.Errorf("Unknown layout '%s'", name)
+}
+
+// RowMajor lays cells line by line in a square
+type RowMajor struct{}
+
+type rowMajorGrid struct {
+	size model.Size
+}
+
+func (RowMajor) GetGrid(numCells int, blocksPerCell int) Grid {
+	return &rowMajorGrid{model.GetGridSize(numCells)}
+}
+
+func (g *rowMajorGrid) Size() model.Size {
+	return g.size
+}
+
+func (g *rowMajorGrid) Position(cell int) model.Coordinate {
+	return model.Coordinate{X: cell % g.size.Width, Y: cell / g.size.Width}
+}
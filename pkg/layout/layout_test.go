@@ -0,0 +1,75 @@
+package layout
+
+import (
+	"testing"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowMajor(t *testing.T) {
+	grid := RowMajor{}.GetGrid(5, 1)
+	require.Equal(t, model.Size{Width: 3, Height: 2}, grid.Size())
+	require.Equal(t, model.Coordinate{X: 1, Y: 1}, grid.Position(4))
+}
+
+func TestHilbert(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		numCells     int
+		expectedSize model.Size
+	}{
+		{"Test single cell", 1, model.Size{Width: 1, Height: 1}},
+		{"Test full square", 16, model.Size{Width: 4, Height: 4}},
+		{"Test half square", 8, model.Size{Width: 2, Height: 4}},
+		{"Test partial square", 50, model.Size{Width: 8, Height: 8}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			grid := Hilbert{}.GetGrid(tC.numCells, 1)
+			require.Equal(t, tC.expectedSize, grid.Size())
+
+			// Consecutive cells are always neighbours
+			seen := make(map[model.Coordinate]bool)
+			previous := grid.Position(0)
+			seen[previous] = true
+			for i := 1; i < tC.numCells; i++ {
+				c := grid.Position(i)
+				distance := abs(c.X-previous.X) + abs(c.Y-previous.Y)
+				require.Equal(t, 1, distance, "cell %d", i)
+				require.False(t, seen[c])
+				seen[c] = true
+				previous = c
+			}
+		})
+	}
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func TestSegment(t *testing.T) {
+	// 3 segments of 131072 blocks aggregated by 512 blocks
+	numCells := 3 * model.BlocksPerSegment / 512
+	grid := Segment{}.GetGrid(numCells, 512)
+	require.Equal(t, model.Size{Width: rulerWidth + 16, Height: 1 + 3*(16+1)}, grid.Size())
+
+	// First cell of each segment starts a band after its header row
+	require.Equal(t, model.Coordinate{X: rulerWidth, Y: 2}, grid.Position(0))
+	require.Equal(t, model.Coordinate{X: rulerWidth, Y: 19}, grid.Position(256))
+	require.Equal(t, model.Coordinate{X: rulerWidth + 15, Y: 34}, grid.Position(511))
+
+	relation := model.Relation{Name: "TestRelation", Filepath: "base/5/16384",
+		Fsm: make([]int16, 3*model.BlocksPerSegment)}
+	labels, lines := grid.(Annotator).Annotations(relation)
+	require.Len(t, lines, 3)
+	require.Contains(t, labels, Label{
+		Coordinate: model.Coordinate{X: rulerWidth, Y: 18},
+		Text:       "base/5/16384.1 (blocks 131072-262143)",
+		Class:      "segment",
+	})
+}
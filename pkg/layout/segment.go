@@ -0,0 +1,127 @@
+package layout
+
+import (
+	"fmt"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+)
+
+const (
+	// Width in cells reserved for the block number ruler
+	rulerWidth = 8
+	// Number of rows and columns between two ruler labels
+	rulerRowStep    = 8
+	rulerColumnStep = 16
+)
+
+// Label is a text drawn at a grid coordinate
+type Label struct {
+	model.Coordinate
+	Text  string
+	Class string
+}
+
+// Line is a line drawn between grid coordinates
+type Line struct {
+	From  model.Coordinate
+	To    model.Coordinate
+	Class string
+}
+
+// Annotator is implemented by grids drawing additional elements around
+// the cells
+type Annotator interface {
+	Annotations(relation model.Relation) ([]Label, []Line)
+}
+
+// Segment lays cells in bands of rows, one band per 1GB segment file
+type Segment struct{}
+
+type segmentGrid struct {
+	numCells        int
+	blocksPerCell   int
+	cellsPerSegment int
+	numSegments     int
+	width           int
+	rowsPerSegment  int
+}
+
+func (Segment) GetGrid(numCells int, blocksPerCell int) Grid {
+	g := &segmentGrid{
+		numCells:        numCells,
+		blocksPerCell:   blocksPerCell,
+		cellsPerSegment: max(1, model.BlocksPerSegment/blocksPerCell),
+		width:           1,
+	}
+	g.numSegments = max(1, (numCells+g.cellsPerSegment-1)/g.cellsPerSegment)
+	cellsInBand := min(numCells, g.cellsPerSegment)
+	for g.width*g.width < cellsInBand {
+		g.width *= 2
+	}
+	g.rowsPerSegment = max(1, (cellsInBand+g.width-1)/g.width)
+	return g
+}
+
+func (g *segmentGrid) Size() model.Size {
+	// Top ruler then a header row before each band, the last band may
+	// be partially filled
+	lastSegmentCells := g.numCells - (g.numSegments-1)*g.cellsPerSegment
+	lastSegmentRows := (lastSegmentCells + g.width - 1) / g.width
+	height := g.getSegmentY(g.numSegments-1) + 1 + lastSegmentRows
+	return model.Size{Width: rulerWidth + g.width, Height: height}
+}
+
+func (g *segmentGrid) getSegmentY(segment int) int {
+	return 1 + segment*(g.rowsPerSegment+1)
+}
+
+func (g *segmentGrid) Position(cell int) model.Coordinate {
+	segment := cell / g.cellsPerSegment
+	offset := cell % g.cellsPerSegment
+	return model.Coordinate{
+		X: rulerWidth + offset%g.width,
+		Y: g.getSegmentY(segment) + 1 + offset/g.width,
+	}
+}
+
+func (g *segmentGrid) Annotations(relation model.Relation) ([]Label, []Line) {
+	labels := make([]Label, 0)
+	lines := make([]Line, 0)
+
+	for column := 0; column < g.width; column += rulerColumnStep {
+		labels = append(labels, Label{
+			Coordinate: model.Coordinate{X: rulerWidth + column, Y: 0},
+			Text:       fmt.Sprintf("+%d", column*g.blocksPerCell),
+			Class:      "ruler",
+		})
+	}
+
+	for segment := range g.numSegments {
+		y := g.getSegmentY(segment)
+		firstBlock := segment * g.cellsPerSegment * g.blocksPerCell
+		lastBlock := min(firstBlock+g.cellsPerSegment*g.blocksPerCell, relation.GetNumbBuffers()) - 1
+		labels = append(labels, Label{
+			Coordinate: model.Coordinate{X: rulerWidth, Y: y},
+			Text:       fmt.Sprintf("%s (blocks %d-%d)", relation.GetSegmentName(segment), firstBlock, lastBlock),
+			Class:      "segment",
+		})
+		lines = append(lines, Line{
+			From:  model.Coordinate{X: 0, Y: y + 1},
+			To:    model.Coordinate{X: rulerWidth + g.width, Y: y + 1},
+			Class: "segment-boundary",
+		})
+
+		for row := 0; row < g.rowsPerSegment; row += rulerRowStep {
+			cell := segment*g.cellsPerSegment + row*g.width
+			if cell >= g.numCells {
+				break
+			}
+			labels = append(labels, Label{
+				Coordinate: model.Coordinate{X: rulerWidth - 1, Y: y + 1 + row},
+				Text:       fmt.Sprintf("%d", cell*g.blocksPerCell),
+				Class:      "ruler ruler-row",
+			})
+		}
+	}
+	return labels, lines
+}
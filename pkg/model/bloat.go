@@ -0,0 +1,196 @@
+package model
+
+import "fmt"
+
+// Bloat is the space of a relation that maintenance could reclaim,
+// estimated from the fetched per-block data
+type Bloat struct {
+	Relation string `json:"relation"`
+	Blocks   int    `json:"blocks"`
+	// Blocks without live data
+	EmptyBlocks int `json:"empty_blocks"`
+	// Empty blocks at the end of a heap that VACUUM can truncate
+	TruncatableBlocks int `json:"truncatable_blocks"`
+	// Free space reported by the FSM, or by the index pages or pgstatindex
+	// when fetched
+	FreeBytes int64 `json:"free_bytes"`
+	// Estimated size of the dead tuples or index items
+	DeadBytes int64 `json:"dead_bytes"`
+	// Whether empty and truncatable blocks are estimated from the FSM, the
+	// tuples or index pages not being fetched. The FSM is only updated by
+	// VACUUM and can lag behind the heap.
+	FsmEstimate bool `json:"fsm_estimate"`
+	// Whether the free space of a btree only comes from the FSM. It only
+	// tracks recycled pages and misses the free space of sparse leaves.
+	FsmOnly bool `json:"fsm_only"`
+}
+
+// FormatSize returns a size in bytes with a binary unit
+func FormatSize(bytes int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	size := float64(bytes)
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
+
+func (b *Bloat) GetSize() int64 {
+	return int64(b.Blocks) * BlockSize
+}
+
+// GetReclaimable returns the space a rewrite like VACUUM FULL would free
+func (b *Bloat) GetReclaimable() int64 {
+	return min(b.FreeBytes+b.DeadBytes, b.GetSize())
+}
+
+func (b *Bloat) GetReclaimablePercent() float64 {
+	if b.Blocks == 0 {
+		return 0
+	}
+	return float64(b.GetReclaimable()) * 100 / float64(b.GetSize())
+}
+
+func (b *Bloat) String() string {
+	s := fmt.Sprintf("%s reclaimable of %s (%.1f%%), %s free, %s dead, %d/%d empty blocks",
+		FormatSize(b.GetReclaimable()), FormatSize(b.GetSize()), b.GetReclaimablePercent(),
+		FormatSize(b.FreeBytes), FormatSize(b.DeadBytes), b.EmptyBlocks, b.Blocks)
+	if b.TruncatableBlocks > 0 {
+		s = fmt.Sprintf("%s, %d trailing blocks (%s) truncatable by VACUUM", s,
+			b.TruncatableBlocks, FormatSize(int64(b.TruncatableBlocks)*BlockSize))
+	}
+	if b.FsmOnly {
+		s += ", FSM only estimate missing the free space of leaf pages"
+	} else if b.FsmEstimate {
+		s += ", empty blocks estimated from the FSM"
+	}
+	return s
+}
+
+func (r *Relation) isHeap() bool {
+	return r.AccessMethod == ""
+}
+
+// isFsmEstimate returns whether empty blocks can only be estimated from the
+// FSM
+func (r *Relation) isFsmEstimate() bool {
+	return r.Tuples == nil && r.IndexPages == nil && !r.hasBtreeStats()
+}
+
+// hasBtreeStats returns whether the free space of a btree can be derived
+// from pgstatindex, its pages not being fetched
+func (r *Relation) hasBtreeStats() bool {
+	return r.AccessMethod == "btree" && r.IndexPages == nil && r.IndexStats != nil
+}
+
+// setBtreeFreeBytes derives the free space of a btree from the density of
+// its leaf pages, empty and deleted pages being entirely free
+func (r *Relation) setBtreeFreeBytes(b *Bloat) {
+	usable := BlockSize - PageHeaderSize - BtreeSpecialSize
+	emptyPages := r.IndexStats.EmptyPages + r.IndexStats.DeletedPages
+	leafFree := float64(r.IndexStats.LeafPages) * (1 - r.IndexStats.AvgLeafDensity/100) * float64(usable)
+	b.FreeBytes = int64(leafFree) + emptyPages*BlockSize
+	b.EmptyBlocks = int(emptyPages)
+}
+
+// isEmptyBlock returns true when a block holds no live data. Heap blocks
+// with only dead tuples are empty as VACUUM will remove them. Without tuples
+// or index pages, blocks fully free in the FSM are considered empty.
+func (r *Relation) isEmptyBlock(block int) bool {
+	if block < len(r.Tuples) {
+		return r.Tuples[block].Live == 0
+	}
+	if block < len(r.IndexPages) {
+		pageType := r.IndexPages[block].Type
+		if pageType == PageTypeDeleted || pageType == PageTypeUnused {
+			return true
+		}
+	}
+	return r.Fsm[block] >= MaxFreeSpace
+}
+
+// GetTruncatableBlocks returns the number of empty blocks at the end of a
+// heap. VACUUM returns them to the filesystem if it can get an exclusive
+// lock. Indexes are never truncated.
+func (r *Relation) GetTruncatableBlocks() int {
+	if !r.isHeap() {
+		return 0
+	}
+	truncatable := 0
+	for block := r.GetNumbBuffers() - 1; block >= 0 && r.isEmptyBlock(block); block-- {
+		truncatable++
+	}
+	return truncatable
+}
+
+// getDeadBytes estimates the size of dead tuples with the average size of
+// live tuples, and the size of dead index items with the average item size
+// of their page
+func (r *Relation) getDeadBytes() int64 {
+	var deadBytes int64
+	if r.Tuples != nil {
+		live, liveBytes, dead := 0, 0, 0
+		for _, t := range r.Tuples {
+			live += t.Live
+			liveBytes += t.LiveBytes
+			dead += t.Dead
+		}
+		if live > 0 {
+			deadBytes = int64(dead) * int64(liveBytes) / int64(live)
+		}
+	}
+	for _, page := range r.IndexPages {
+		items := page.LiveItems + page.DeadItems
+		if items > 0 {
+			used := BlockSize - PageHeaderSize - page.FreeSize
+			deadBytes += int64(used * page.DeadItems / items)
+		}
+	}
+	return deadBytes
+}
+
+// GetBloat estimates the reclaimable space of the relation
+func (r *Relation) GetBloat() Bloat {
+	b := Bloat{
+		Relation:          r.Name,
+		Blocks:            r.GetNumbBuffers(),
+		TruncatableBlocks: r.GetTruncatableBlocks(),
+		DeadBytes:         r.getDeadBytes(),
+		FsmEstimate:       r.isFsmEstimate(),
+		FsmOnly:           r.AccessMethod == "btree" && r.IndexPages == nil && r.IndexStats == nil,
+	}
+	if r.hasBtreeStats() {
+		r.setBtreeFreeBytes(&b)
+		return b
+	}
+	for block := 0; block < b.Blocks; block++ {
+		if r.isEmptyBlock(block) {
+			b.EmptyBlocks++
+		}
+		if block < len(r.IndexPages) {
+			pageType := r.IndexPages[block].Type
+			if pageType == PageTypeDeleted || pageType == PageTypeUnused {
+				b.FreeBytes += BlockSize
+			} else if pageType != PageTypeMeta {
+				b.FreeBytes += int64(r.IndexPages[block].FreeSize)
+			}
+		} else {
+			b.FreeBytes += int64(r.Fsm[block])
+		}
+	}
+	return b
+}
+
+// GetBloat returns the estimated reclaimable space of the table's relations
+func (t *Table) GetBloat() []Bloat {
+	bloat := make([]Bloat, 0)
+	for _, relation := range t.GetRelations() {
+		bloat = append(bloat, relation.GetBloat())
+	}
+	return bloat
+}
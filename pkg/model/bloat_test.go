@@ -0,0 +1,86 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloat(t *testing.T) {
+	heap := Relation{
+		Name: "heap",
+		Fsm:  []int16{100, 0, MaxFreeSpace, 0, 0},
+		Tuples: []TupleCount{
+			{Live: 10, Dead: 2, LiveBytes: 1000},
+			{Live: 30, Dead: 0, LiveBytes: 3000},
+			{Live: 0, Dead: 0},
+			{Live: 0, Dead: 5},
+			{Live: 0, Dead: 1},
+		},
+	}
+	bloat := heap.GetBloat()
+	require.Equal(t, 5, bloat.Blocks)
+	require.Equal(t, 3, bloat.EmptyBlocks)
+	require.Equal(t, 3, bloat.TruncatableBlocks)
+	require.Equal(t, int64(100+MaxFreeSpace), bloat.FreeBytes)
+	require.Equal(t, int64(8*100), bloat.DeadBytes)
+	require.Equal(t, int64(100+MaxFreeSpace+800), bloat.GetReclaimable())
+	require.False(t, bloat.FsmEstimate)
+
+	cells := heap.GetCells(2)
+	require.False(t, cells[0].Truncatable)
+	require.True(t, cells[1].Truncatable)
+	require.True(t, cells[2].Truncatable)
+	require.False(t, heap.GetCells(4)[0].Truncatable)
+
+	// The FSM doesn't know yet the trailing blocks are empty
+	heap.Tuples = nil
+	bloat = heap.GetBloat()
+	require.True(t, bloat.FsmEstimate)
+	require.Equal(t, 0, bloat.TruncatableBlocks)
+	require.Equal(t, 1, bloat.EmptyBlocks)
+	require.Contains(t, bloat.String(), "empty blocks estimated from the FSM")
+
+	index := Relation{
+		Name:         "index",
+		AccessMethod: "btree",
+		Fsm:          []int16{0, 0, MaxFreeSpace},
+		IndexPages: []IndexPage{
+			{Type: PageTypeMeta},
+			{Type: "leaf", LiveItems: 3, DeadItems: 1, FreeSize: 8168 - 400},
+			{Type: PageTypeDeleted},
+		},
+	}
+	bloat = index.GetBloat()
+	require.Equal(t, 0, bloat.TruncatableBlocks)
+	require.Equal(t, 1, bloat.EmptyBlocks)
+	require.Equal(t, int64(8168-400+BlockSize), bloat.FreeBytes)
+	require.Equal(t, int64(100), bloat.DeadBytes)
+}
+
+func TestBtreeBloat(t *testing.T) {
+	index := Relation{
+		Name:         "index",
+		AccessMethod: "btree",
+		Fsm:          []int16{0, 0, 0, MaxFreeSpace},
+	}
+	bloat := index.GetBloat()
+	require.True(t, bloat.FsmOnly)
+	require.Equal(t, int64(MaxFreeSpace), bloat.FreeBytes)
+	require.Contains(t, bloat.String(), "FSM only estimate")
+
+	// Two half full leaves and a deleted page
+	index.IndexStats = &IndexStats{LeafPages: 2, DeletedPages: 1, AvgLeafDensity: 50}
+	bloat = index.GetBloat()
+	require.False(t, bloat.FsmOnly)
+	require.False(t, bloat.FsmEstimate)
+	require.Equal(t, 1, bloat.EmptyBlocks)
+	require.Equal(t, int64(BlockSize-PageHeaderSize-BtreeSpecialSize+BlockSize), bloat.FreeBytes)
+	require.NotContains(t, bloat.String(), "FSM")
+}
+
+func TestFormatSize(t *testing.T) {
+	require.Equal(t, "512 B", FormatSize(512))
+	require.Equal(t, "8.0 kB", FormatSize(BlockSize))
+	require.Equal(t, "1.5 GB", FormatSize(3*512*1024*1024))
+}
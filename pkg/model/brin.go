@@ -0,0 +1,158 @@
+package model
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BrinRange is a range of heap blocks summarized by a BRIN index
+type BrinRange struct {
+	Start      int
+	Summarized bool
+	// Summary of the index's first column as returned by brin_page_items,
+	// like "{1 .. 100}" for minmax
+	Value string
+	// Number of other ranges whose summary overlaps this one, -1 when the
+	// summary can't be compared
+	Overlaps int
+}
+
+// BrinSummary lists the ranges covering the heap of a BRIN index
+type BrinSummary struct {
+	Index         string
+	PagesPerRange int
+	Ranges        []BrinRange
+}
+
+// NewBrinSummary builds the ranges covering numBlocks heap blocks from the
+// summaries indexed by the ranges' first block. Ranges without summary are
+// unsummarized.
+func NewBrinSummary(index string, pagesPerRange int, numBlocks int, values map[int]string) BrinSummary {
+	s := BrinSummary{Index: index, PagesPerRange: pagesPerRange, Ranges: make([]BrinRange, 0)}
+	for start := 0; start < numBlocks; start += pagesPerRange {
+		value, summarized := values[start]
+		s.Ranges = append(s.Ranges, BrinRange{Start: start, Summarized: summarized, Value: value})
+	}
+	s.computeOverlaps()
+	return s
+}
+
+func (r *BrinRange) GetEnd(pagesPerRange int) int {
+	return r.Start + pagesPerRange - 1
+}
+
+// brinTimeLayouts are the ISO output formats of date, timestamp and
+// timestamptz bounds
+var brinTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// parseBound converts a bound of a minmax summary to a number, timestamps
+// and dates being converted to microseconds since the epoch
+func parseBound(bound string) (float64, bool) {
+	if value, err := strconv.ParseFloat(bound, 64); err == nil {
+		return value, true
+	}
+	for _, layout := range brinTimeLayouts {
+		if t, err := time.Parse(layout, bound); err == nil {
+			return float64(t.UnixMicro()), true
+		}
+	}
+	return 0, false
+}
+
+// parseMinMax extracts the bounds of a minmax summary like "{1 .. 100}" or
+// "{2024-01-01 00:00:00 .. 2024-01-31 23:59:59}"
+func parseMinMax(value string) (low float64, high float64, ok bool) {
+	if !strings.HasPrefix(value, "{") || !strings.HasSuffix(value, "}") {
+		return 0, 0, false
+	}
+	bounds := strings.Split(value[1:len(value)-1], " .. ")
+	if len(bounds) != 2 {
+		return 0, 0, false
+	}
+	low, lowOk := parseBound(bounds[0])
+	high, highOk := parseBound(bounds[1])
+	return low, high, lowOk && highOk
+}
+
+// computeOverlaps counts for each summarized range the other ranges whose
+// bounds intersect. Overlaps stay unknown when a summary isn't a number,
+// a date or a timestamp.
+func (s *BrinSummary) computeOverlaps() {
+	lows := make([]float64, 0)
+	highs := make([]float64, 0)
+	for i := range s.Ranges {
+		s.Ranges[i].Overlaps = -1
+	}
+	for i := range s.Ranges {
+		if !s.Ranges[i].Summarized {
+			continue
+		}
+		low, high, ok := parseMinMax(s.Ranges[i].Value)
+		if !ok {
+			return
+		}
+		lows = append(lows, low)
+		highs = append(highs, high)
+	}
+	sortedLows := slices.Clone(lows)
+	slices.Sort(sortedLows)
+	sortedHighs := slices.Clone(highs)
+	slices.Sort(sortedHighs)
+	i := 0
+	for j := range s.Ranges {
+		if !s.Ranges[j].Summarized {
+			continue
+		}
+		// Ranges starting at or below our high bound, minus the ones ending
+		// below our low bound, minus ourself
+		startingBefore := sort.Search(len(sortedLows), func(k int) bool { return sortedLows[k] > highs[i] })
+		endingBefore := sort.SearchFloat64s(sortedHighs, lows[i])
+		s.Ranges[j].Overlaps = startingBefore - endingBefore - 1
+		i++
+	}
+}
+
+// GetRange returns the range holding a heap block
+func (s *BrinSummary) GetRange(block int) *BrinRange {
+	i := block / s.PagesPerRange
+	if i >= len(s.Ranges) {
+		return nil
+	}
+	return &s.Ranges[i]
+}
+
+// GetNumUnsummarized returns the number of ranges without summary
+func (s *BrinSummary) GetNumUnsummarized() int {
+	unsummarized := 0
+	for _, r := range s.Ranges {
+		if !r.Summarized {
+			unsummarized++
+		}
+	}
+	return unsummarized
+}
+
+// GetNumRanges returns the number of ranges holding blocks between start
+// and end
+func (s *BrinSummary) GetNumRanges(start int, end int) int {
+	return end/s.PagesPerRange - start/s.PagesPerRange + 1
+}
+
+// GetBrin returns the summary of the relation's BRIN index, nil when the
+// index isn't a summarized BRIN index of the relation
+func (r *Relation) GetBrin(index string) *BrinSummary {
+	for i := range r.Brin {
+		if r.Brin[i].Index == index {
+			return &r.Brin[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrinSummary(t *testing.T) {
+	summary := NewBrinSummary("idx", 4, 14, map[int]string{
+		0: "{1 .. 10}",
+		4: "{11 .. 20}",
+		8: "{5 .. 15}",
+	})
+	require.Len(t, summary.Ranges, 4)
+	require.Equal(t, 1, summary.GetNumUnsummarized())
+	require.Equal(t, []int{1, 1, 2, -1}, []int{
+		summary.Ranges[0].Overlaps, summary.Ranges[1].Overlaps,
+		summary.Ranges[2].Overlaps, summary.Ranges[3].Overlaps,
+	})
+	require.Equal(t, 8, summary.GetRange(9).Start)
+	require.Equal(t, 11, summary.GetRange(9).GetEnd(4))
+	require.Nil(t, summary.GetRange(16))
+	require.Equal(t, 1, summary.GetNumRanges(4, 7))
+	require.Equal(t, 3, summary.GetNumRanges(2, 9))
+
+	text := NewBrinSummary("idx", 4, 8, map[int]string{0: "{a .. b}", 4: "{c .. d}"})
+	require.Equal(t, -1, text.Ranges[0].Overlaps)
+	require.Equal(t, -1, text.Ranges[1].Overlaps)
+}
+
+func TestBrinSummaryTimestamps(t *testing.T) {
+	timestamps := NewBrinSummary("idx", 4, 12, map[int]string{
+		0: "{2024-01-01 00:00:00 .. 2024-01-31 23:59:59.5}",
+		4: "{2024-02-01 00:00:00 .. 2024-02-29 00:00:00}",
+		8: "{2024-01-15 12:00:00 .. 2024-01-20 00:00:00}",
+	})
+	require.Equal(t, []int{1, 0, 1}, []int{
+		timestamps.Ranges[0].Overlaps, timestamps.Ranges[1].Overlaps, timestamps.Ranges[2].Overlaps,
+	})
+
+	timestamptz := NewBrinSummary("idx", 4, 8, map[int]string{
+		0: "{2024-01-01 00:00:00+00 .. 2024-01-01 10:00:00+00}",
+		4: "{2024-01-01 12:00:00+05:30 .. 2024-01-02 00:00:00+05:30}",
+	})
+	// 12:00+05:30 is 06:30 UTC, inside the first range
+	require.Equal(t, 1, timestamptz.Ranges[0].Overlaps)
+
+	dates := NewBrinSummary("idx", 4, 8, map[int]string{
+		0: "{2024-01-01 .. 2024-01-10}",
+		4: "{2024-01-11 .. 2024-01-20}",
+	})
+	require.Equal(t, 0, dates.Ranges[0].Overlaps)
+	require.Equal(t, 0, dates.Ranges[1].Overlaps)
+}
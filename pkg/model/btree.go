@@ -0,0 +1,350 @@
+package model
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rotisserie/eris"
+)
+
+// BtreeSpecialSize is the size of the special space of btree pages
+const BtreeSpecialSize = 16
+
+// BtreePage is a page of a btree index as returned by bt_page_stats
+type BtreePage struct {
+	Block     int
+	Type      string
+	LiveItems int
+	DeadItems int
+	FreeSize  int
+	Prev      int
+	Next      int
+	Level     int
+	Flags     int
+}
+
+// BtreeMeta is the metapage of a btree index as returned by bt_metap
+type BtreeMeta struct {
+	Root      int
+	Level     int
+	FastRoot  int
+	FastLevel int
+}
+
+// BtreeNode is a page of a btree index with the blocks its downlinks point
+// to, empty for leaves
+type BtreeNode struct {
+	BtreePage
+	Children []int
+}
+
+// BtreeTree holds the pages of a btree index by level, from the root to
+// the leaves, each level in key order
+type BtreeTree struct {
+	Index  string
+	Meta   BtreeMeta
+	Levels [][]BtreeNode
+}
+
+// LeafPage lists the heap blocks referenced by the items of a btree leaf
+// page, in key order
+type LeafPage struct {
+	Block      int
+	HeapBlocks []int
+}
+
+// IndexCorrelation describes how the heap follows an index's key order
+type IndexCorrelation struct {
+	Index string
+	// Heap block of each leaf item in key order
+	HeapBlocks []int
+	// Number of distinct heap blocks referenced
+	NumHeapBlocks int
+	// Number of heap block changes while reading items in key order
+	ClusteringFactor int
+}
+
+// IsDeleted returns whether the page is deleted or half dead
+func (p *BtreePage) IsDeleted() bool {
+	return p.Type == "d" || p.Type == "e"
+}
+
+// GetFirstDataItem returns the offset of the page's first data item. The
+// first item of a page that isn't the rightmost of its level is its high
+// key.
+func (p *BtreePage) GetFirstDataItem() int {
+	if p.Next != 0 {
+		return 2
+	}
+	return 1
+}
+
+func (p *BtreePage) IsLeaf() bool {
+	return p.Level == 0 && !p.IsDeleted()
+}
+
+// GetFill returns the fraction of the page's item space in use
+func (p *BtreePage) GetFill() float64 {
+	usable := BlockSize - PageHeaderSize - BtreeSpecialSize
+	return 1 - float64(p.FreeSize)/float64(usable)
+}
+
+// GetLevelChain returns the pages of a level in key order by following the
+// right links from the leftmost page
+func GetLevelChain(pages []BtreePage, level int) []BtreePage {
+	pagesByBlock := make(map[int]BtreePage)
+	leftmost := -1
+	for _, page := range pages {
+		pagesByBlock[page.Block] = page
+		if page.Level == level && !page.IsDeleted() && page.Prev == 0 && leftmost < 0 {
+			leftmost = page.Block
+		}
+	}
+	chain := make([]BtreePage, 0)
+	seen := make(map[int]bool)
+	for block := leftmost; block > 0 && !seen[block]; {
+		page, ok := pagesByBlock[block]
+		if !ok {
+			break
+		}
+		seen[block] = true
+		chain = append(chain, page)
+		block = page.Next
+	}
+	return chain
+}
+
+// NewBtreeTree arranges the pages of a btree index by level using the
+// downlinks of its internal pages
+func NewBtreeTree(index string, meta BtreeMeta, pages []BtreePage, downlinks map[int][]int) BtreeTree {
+	t := BtreeTree{Index: index, Meta: meta, Levels: make([][]BtreeNode, 0)}
+	for level := meta.Level; level >= 0; level-- {
+		chain := GetLevelChain(pages, level)
+		nodes := make([]BtreeNode, len(chain))
+		for i, page := range chain {
+			nodes[i] = BtreeNode{BtreePage: page, Children: downlinks[page.Block]}
+		}
+		t.Levels = append(t.Levels, nodes)
+	}
+	return t
+}
+
+// GetNumItems returns the number of live items of a level
+func (t *BtreeTree) GetNumItems(level int) int {
+	numItems := 0
+	for _, node := range t.Levels[level] {
+		numItems += node.LiveItems
+	}
+	return numItems
+}
+
+// GetFanout returns the average number of children of the internal pages
+func (t *BtreeTree) GetFanout() float64 {
+	numInternal, numChildren := 0, 0
+	for level := 1; level < len(t.Levels); level++ {
+		numInternal += len(t.Levels[level-1])
+		numChildren += len(t.Levels[level])
+	}
+	if numInternal == 0 {
+		return 0
+	}
+	return float64(numChildren) / float64(numInternal)
+}
+
+// NewIndexCorrelation computes the clustering factor of the leaf pages' items
+func NewIndexCorrelation(index string, leaves []LeafPage) IndexCorrelation {
+	c := IndexCorrelation{Index: index, HeapBlocks: make([]int, 0)}
+	distinct := make(map[int]bool)
+	previous := -1
+	for _, leaf := range leaves {
+		for _, heapBlock := range leaf.HeapBlocks {
+			if heapBlock != previous {
+				c.ClusteringFactor++
+				previous = heapBlock
+			}
+			distinct[heapBlock] = true
+			c.HeapBlocks = append(c.HeapBlocks, heapBlock)
+		}
+	}
+	c.NumHeapBlocks = len(distinct)
+	return c
+}
+
+// GetClusteringRatio normalizes the clustering factor between 0, every
+// item jumps to another heap block, and 1, each heap block is read once
+func (c *IndexCorrelation) GetClusteringRatio() float64 {
+	numItems := len(c.HeapBlocks)
+	if numItems <= c.NumHeapBlocks {
+		return 1
+	}
+	return float64(numItems-c.ClusteringFactor) / float64(numItems-c.NumHeapBlocks)
+}
+
+// BtreeItem is an item of a btree page as returned by bt_page_items
+type BtreeItem struct {
+	Offset int
+	// Child block pointed to by a pivot item
+	Downlink int
+	Nulls    bool
+	// Key data as space separated hex bytes
+	Data string
+	// Number of heap tids, more than one for posting lists
+	NumTids int
+}
+
+// DecodeFirstKey decodes the first key column of the item into a literal of
+// its type. Only integer, uuid and uncompressed text keys of a little endian
+// server are supported.
+func (i *BtreeItem) DecodeFirstKey(typeName string) (string, error) {
+	raw, err := hex.DecodeString(strings.ReplaceAll(i.Data, " ", ""))
+	if err != nil {
+		return "", eris.Wrapf(err, "Invalid data of item %d", i.Offset)
+	}
+	fixedSizes := map[string]int{"int2": 2, "int4": 4, "oid": 4, "int8": 8, "uuid": 16}
+	if size, ok := fixedSizes[typeName]; ok && len(raw) < size {
+		return "", eris.Errorf("Item %d is too short for a %s key", i.Offset, typeName)
+	}
+	switch typeName {
+	case "int2":
+		return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(raw)))), nil
+	case "int4":
+		return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(raw)))), nil
+	case "oid":
+		return strconv.FormatUint(uint64(binary.LittleEndian.Uint32(raw)), 10), nil
+	case "int8":
+		return strconv.FormatInt(int64(binary.LittleEndian.Uint64(raw)), 10), nil
+	case "uuid":
+		return hex.EncodeToString(raw[:16]), nil
+	case "text", "varchar", "bpchar":
+		return decodeVarlena(i.Offset, raw)
+	}
+	return "", eris.Errorf("Keys of type %s can't be decoded", typeName)
+}
+
+// decodeVarlena returns the content of an inline, uncompressed varlena
+func decodeVarlena(offset int, raw []byte) (string, error) {
+	if len(raw) == 0 {
+		return "", eris.Errorf("Item %d has no key data", offset)
+	}
+	// A 1 byte header stores the total length shifted by one
+	if raw[0]&0x01 == 0x01 {
+		length := int(raw[0] >> 1)
+		if length == 0 || length > len(raw) {
+			return "", eris.Errorf("Item %d has an unsupported varlena header", offset)
+		}
+		return string(raw[1:length]), nil
+	}
+	if len(raw) < 4 {
+		return "", eris.Errorf("Item %d is too short for a varlena", offset)
+	}
+	header := binary.LittleEndian.Uint32(raw)
+	if header&0x03 == 0x02 {
+		return "", eris.Errorf("Item %d has a compressed key", offset)
+	}
+	length := int(header >> 2)
+	if length < 4 || length > len(raw) {
+		return "", eris.Errorf("Item %d has an invalid varlena length", offset)
+	}
+	return string(raw[4:length]), nil
+}
+
+// BtreeLookupPage is a page read during a key lookup with its items and
+// their comparison with the key in index order: -1 when the item is lower,
+// 0 when equal and 1 when greater
+type BtreeLookupPage struct {
+	BtreePage
+	Items []BtreeItem
+	Cmps  []int
+}
+
+// getFirstDataIndex returns the position of the first data item in Items
+func (p *BtreeLookupPage) getFirstDataIndex() int {
+	return p.GetFirstDataItem() - 1
+}
+
+// MustMoveRight returns whether the key is beyond the page's high key, the
+// page having been split since its parent was read
+func (p *BtreeLookupPage) MustMoveRight() bool {
+	return p.Next != 0 && len(p.Cmps) > 0 && p.Cmps[0] < 0
+}
+
+// GetDownlink returns the child to descend to from an internal page: the
+// downlink of the last item lower than the key, the first data item being
+// minus infinity. Equal items are descended on their left as the leaf scan
+// moves right anyway.
+func (p *BtreeLookupPage) GetDownlink() (int, error) {
+	first := p.getFirstDataIndex()
+	if first >= len(p.Items) {
+		return 0, eris.Errorf("Internal page %d has no downlink", p.Block)
+	}
+	chosen := first
+	for i := first + 1; i < len(p.Items) && p.Cmps[i] < 0; i++ {
+		chosen = i
+	}
+	return p.Items[chosen].Downlink, nil
+}
+
+// GetMatchingTids returns the number of heap tids of a leaf's items equal
+// to the key
+func (p *BtreeLookupPage) GetMatchingTids() int {
+	numTids := 0
+	for i := p.getFirstDataIndex(); i < len(p.Items); i++ {
+		if p.Cmps[i] == 0 {
+			numTids += p.Items[i].NumTids
+		}
+	}
+	return numTids
+}
+
+// EndsScan returns whether no leaf on the right of this one can hold the
+// key: the leaf is the rightmost, or its high key or one of its items is
+// greater than the key
+func (p *BtreeLookupPage) EndsScan() bool {
+	if p.Next == 0 || (len(p.Cmps) > 0 && p.Cmps[0] > 0) {
+		return true
+	}
+	return slices.ContainsFunc(p.Cmps[p.getFirstDataIndex():], func(cmp int) bool {
+		return cmp > 0
+	})
+}
+
+// KeyLookup is the descent of a key lookup through a btree index
+type KeyLookup struct {
+	Index string
+	Key   string
+	// Pages read from the root to the first leaf holding the key, then
+	// the leaves read on its right up to the last one that can hold it
+	Path []int
+	// Number of matching items per leaf page
+	LeafItems map[int]int
+}
+
+// NewKeyLookup creates an empty lookup of the key
+func NewKeyLookup(index string, key string) KeyLookup {
+	return KeyLookup{Index: index, Key: key, Path: make([]int, 0), LeafItems: make(map[int]int)}
+}
+
+// AddPage records a page read by the lookup
+func (l *KeyLookup) AddPage(page BtreeLookupPage) {
+	l.Path = append(l.Path, page.Block)
+	if page.IsLeaf() {
+		if numTids := page.GetMatchingTids(); numTids > 0 {
+			l.LeafItems[page.Block] = numTids
+		}
+	}
+}
+
+// GetHighlight returns the index blocks to highlight, with the number of
+// matching items for leaves and 1 for the other visited pages
+func (l *KeyLookup) GetHighlight(numBlocks int) []int {
+	highlight := make([]int, numBlocks)
+	for _, block := range l.Path {
+		if block < numBlocks {
+			highlight[block] = max(1, l.LeafItems[block])
+		}
+	}
+	return highlight
+}
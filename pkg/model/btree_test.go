@@ -0,0 +1,117 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexCorrelation(t *testing.T) {
+	ordered := NewIndexCorrelation("idx", []LeafPage{
+		{Block: 1, HeapBlocks: []int{0, 0, 0, 1}},
+		{Block: 2, HeapBlocks: []int{1, 1, 2, 2}},
+	})
+	require.Equal(t, 8, len(ordered.HeapBlocks))
+	require.Equal(t, 3, ordered.NumHeapBlocks)
+	require.Equal(t, 3, ordered.ClusteringFactor)
+	require.Equal(t, 1.0, ordered.GetClusteringRatio())
+
+	scattered := NewIndexCorrelation("idx", []LeafPage{
+		{Block: 1, HeapBlocks: []int{0, 1, 2, 0}},
+		{Block: 2, HeapBlocks: []int{1, 2}},
+	})
+	require.Equal(t, 3, scattered.NumHeapBlocks)
+	require.Equal(t, 6, scattered.ClusteringFactor)
+	require.Equal(t, 0.0, scattered.GetClusteringRatio())
+}
+
+func TestBtreeTree(t *testing.T) {
+	// Root 3 with leaves 1 -> 4 -> 2, leaf 5 is deleted
+	pages := []BtreePage{
+		{Block: 1, Type: "l", LiveItems: 10, Next: 4},
+		{Block: 2, Type: "l", LiveItems: 30, Prev: 4},
+		{Block: 3, Type: "r", LiveItems: 3, Level: 1},
+		{Block: 4, Type: "l", LiveItems: 20, Prev: 1, Next: 2},
+		{Block: 5, Type: "d"},
+	}
+	require.Equal(t, []BtreePage{pages[0], pages[3], pages[1]}, GetLevelChain(pages, 0))
+
+	tree := NewBtreeTree("idx", BtreeMeta{Root: 3, Level: 1, FastRoot: 3, FastLevel: 1},
+		pages, map[int][]int{3: {1, 4, 2}})
+	require.Len(t, tree.Levels, 2)
+	require.Equal(t, 3, tree.Levels[0][0].Block)
+	require.Equal(t, []int{1, 4, 2}, tree.Levels[0][0].Children)
+	require.Len(t, tree.Levels[1], 3)
+	require.Equal(t, 60, tree.GetNumItems(1))
+	require.Equal(t, 3.0, tree.GetFanout())
+}
+
+func TestDecodeFirstKey(t *testing.T) {
+	cases := []struct {
+		typeName string
+		data     string
+		expected string
+	}{
+		{"int4", "2a 00 00 00", "42"},
+		{"int4", "fe ff ff ff", "-2"},
+		{"int8", "2a 00 00 00 00 00 00 00", "42"},
+		{"int2", "01 01", "257"},
+		{"text", "09 66 6f 6f 00 00 00 00", "foo"},
+		{"text", "1c 00 00 00 66 6f 6f", "foo"},
+	}
+	for _, c := range cases {
+		item := BtreeItem{Data: c.data}
+		key, err := item.DecodeFirstKey(c.typeName)
+		require.NoError(t, err)
+		require.Equal(t, c.expected, key)
+	}
+	item := BtreeItem{Data: "2a 00 00 00"}
+	_, err := item.DecodeFirstKey("numeric")
+	require.Error(t, err)
+}
+
+func TestKeyLookup(t *testing.T) {
+	lookup := NewKeyLookup("idx", "42")
+	// Root 7 with a high key free rightmost page: descend in the second
+	// child as the third pivot is greater than the key
+	root := BtreeLookupPage{
+		BtreePage: BtreePage{Block: 7, Level: 1},
+		Items:     []BtreeItem{{Offset: 1, Downlink: 1}, {Offset: 2, Downlink: 2}, {Offset: 3, Downlink: 4}},
+		Cmps:      []int{-1, -1, 1},
+	}
+	require.False(t, root.MustMoveRight())
+	downlink, err := root.GetDownlink()
+	require.NoError(t, err)
+	require.Equal(t, 2, downlink)
+	lookup.AddPage(root)
+
+	// Leaf 2 ends with matching items and its high key is equal to the key
+	leaf := BtreeLookupPage{
+		BtreePage: BtreePage{Block: 2, Next: 4},
+		Items:     []BtreeItem{{Offset: 1}, {Offset: 2, NumTids: 1}, {Offset: 3, NumTids: 3}},
+		Cmps:      []int{0, -1, 0},
+	}
+	require.False(t, leaf.MustMoveRight())
+	require.False(t, leaf.EndsScan())
+	lookup.AddPage(leaf)
+
+	// Rightmost leaf 4 holds the last matching item
+	last := BtreeLookupPage{
+		BtreePage: BtreePage{Block: 4, Prev: 2},
+		Items:     []BtreeItem{{Offset: 1, NumTids: 1}, {Offset: 2, NumTids: 1}},
+		Cmps:      []int{0, 1},
+	}
+	require.True(t, last.EndsScan())
+	lookup.AddPage(last)
+
+	require.Equal(t, []int{7, 2, 4}, lookup.Path)
+	require.Equal(t, map[int]int{2: 3, 4: 1}, lookup.LeafItems)
+	require.Equal(t, []int{0, 0, 3, 0, 1, 0, 0, 1}, lookup.GetHighlight(8))
+}
+
+func TestFirstDataItem(t *testing.T) {
+	rightmost := BtreePage{Block: 3}
+	require.Equal(t, 1, rightmost.GetFirstDataItem())
+	withHighKey := BtreePage{Block: 2, Next: 3}
+	require.Equal(t, 2, withHighKey.GetFirstDataItem())
+}
@@ -0,0 +1,140 @@
+package model
+
+import (
+	"math"
+	"slices"
+)
+
+// MaxFreeSpace is the highest free space reported by pg_freespace for a block
+const MaxFreeSpace = 8160
+
+// Cell is a group of consecutive blocks drawn as a single element
+type Cell struct {
+	StartBlock int
+	NumBlocks  int
+
+	MinFree int16
+	AvgFree int16
+	MaxFree int16
+
+	// Number of blocks without free space and completely free
+	NumFull  int
+	NumEmpty int
+
+	// Optional per-block information summed over the cell's blocks, only
+	// meaningful when the relation has them
+	NumCached     int
+	NumAllVisible int
+	NumAllFrozen  int
+	Tuples        TupleCount
+	Highlight     int
+	// Sorted heap blocks referenced by the cell's index blocks
+	References []int
+	// Most frequent type and items of the cell's index pages
+	PageType  string
+	LiveItems int
+	DeadItems int
+	// Average free space of the cell's index pages
+	AvgPageFree int
+	// Whether the cell's blocks are in the empty tail VACUUM can truncate
+	Truncatable bool
+}
+
+func (c *Cell) GetEndBlock() int {
+	return c.StartBlock + c.NumBlocks - 1
+}
+
+// GetBlocksPerCell returns the number of blocks to group in a cell to
+// keep the number of cells under maxCells. The result is a power of 2 so
+// cells stay aligned on block ranges.
+func GetBlocksPerCell(numBlocks int, maxCells int) int {
+	blocksPerCell := 1
+	if maxCells <= 0 {
+		return blocksPerCell
+	}
+	for numBlocks > blocksPerCell*maxCells {
+		blocksPerCell *= 2
+	}
+	return blocksPerCell
+}
+
+// GetGridSize returns the size of the square grid holding numElements
+func GetGridSize(numElements int) Size {
+	width := math.Ceil(math.Sqrt(float64(numElements)))
+	height := math.Ceil(float64(numElements) / width)
+	return Size{int(width), int(height)}
+}
+
+func (r *Relation) GetNumCells(blocksPerCell int) int {
+	return (r.GetNumbBuffers() + blocksPerCell - 1) / blocksPerCell
+}
+
+// GetCells aggregates the relation's blocks in cells of blocksPerCell blocks
+func (r *Relation) GetCells(blocksPerCell int) []Cell {
+	numBuffers := r.GetNumbBuffers()
+	cells := make([]Cell, 0, r.GetNumCells(blocksPerCell))
+	truncateStart := numBuffers - r.GetTruncatableBlocks()
+	for start := 0; start < numBuffers; start += blocksPerCell {
+		end := min(start+blocksPerCell, numBuffers)
+		cell := Cell{
+			StartBlock: start,
+			NumBlocks:  end - start,
+			MinFree:    r.Fsm[start],
+			MaxFree:    r.Fsm[start],
+			// Only fully truncatable cells are marked
+			Truncatable: start >= truncateStart,
+		}
+		total := 0
+		for _, avail := range r.Fsm[start:end] {
+			cell.MinFree = min(cell.MinFree, avail)
+			cell.MaxFree = max(cell.MaxFree, avail)
+			total += int(avail)
+			if avail == 0 {
+				cell.NumFull++
+			} else if avail >= MaxFreeSpace {
+				cell.NumEmpty++
+			}
+		}
+		cell.AvgFree = int16(total / cell.NumBlocks)
+		for block := start; block < end; block++ {
+			r.addBlockDetails(&cell, block)
+		}
+		if r.IndexPages != nil {
+			cell.PageType = r.getPageType(start, end)
+			cell.AvgPageFree = r.getAvgPageFree(start, end)
+		}
+		if len(cell.References) > 0 {
+			slices.Sort(cell.References)
+			cell.References = slices.Compact(cell.References)
+		}
+		cells = append(cells, cell)
+	}
+	return cells
+}
+
+func (r *Relation) addBlockDetails(cell *Cell, block int) {
+	if block < len(r.Cached) && r.Cached[block] {
+		cell.NumCached++
+	}
+	if block < len(r.AllVisible) && r.AllVisible[block] {
+		cell.NumAllVisible++
+	}
+	if block < len(r.AllFrozen) && r.AllFrozen[block] {
+		cell.NumAllFrozen++
+	}
+	if block < len(r.Highlight) {
+		cell.Highlight += r.Highlight[block]
+	}
+	if block < len(r.HeapReferences) {
+		cell.References = append(cell.References, r.HeapReferences[block]...)
+	}
+	if block < len(r.IndexPages) {
+		cell.LiveItems += r.IndexPages[block].LiveItems
+		cell.DeadItems += r.IndexPages[block].DeadItems
+	}
+	if block < len(r.Tuples) {
+		cell.Tuples.Live += r.Tuples[block].Live
+		cell.Tuples.Dead += r.Tuples[block].Dead
+		cell.Tuples.LiveBytes += r.Tuples[block].LiveBytes
+	}
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlocksPerCell(t *testing.T) {
+	testCases := []struct {
+		desc                  string
+		numBlocks             int
+		maxCells              int
+		expectedBlocksPerCell int
+	}{
+		{"Test no aggregation", 1000, 0, 1},
+		{"Test under limit", 1000, 1000, 1},
+		{"Test just above limit", 1001, 1000, 2},
+		{"Test power of 2", 5000, 1000, 8},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			require.Equal(t, tC.expectedBlocksPerCell, GetBlocksPerCell(tC.numBlocks, tC.maxCells))
+		})
+	}
+}
+
+func TestGetCells(t *testing.T) {
+	relation := Relation{Name: "TestRelation", Fsm: []int16{0, 100, 8160, 300, 500}}
+	cells := relation.GetCells(2)
+	require.Equal(t, []Cell{
+		{StartBlock: 0, NumBlocks: 2, MinFree: 0, AvgFree: 50, MaxFree: 100, NumFull: 1},
+		{StartBlock: 2, NumBlocks: 2, MinFree: 300, AvgFree: 4230, MaxFree: 8160, NumEmpty: 1},
+		{StartBlock: 4, NumBlocks: 1, MinFree: 500, AvgFree: 500, MaxFree: 500},
+	}, cells)
+	require.Equal(t, 3, cells[1].GetEndBlock())
+}
+
+func TestGetCellsReferences(t *testing.T) {
+	relation := Relation{
+		Name:           "TestIndex",
+		Fsm:            []int16{0, 0, 0},
+		HeapReferences: [][]int{nil, {4, 7}, {2, 4}},
+	}
+	cells := relation.GetCells(1)
+	require.Nil(t, cells[0].References)
+	require.Equal(t, []int{4, 7}, cells[1].References)
+
+	cells = relation.GetCells(2)
+	require.Equal(t, []int{4, 7}, cells[0].References)
+	require.Equal(t, []int{2, 4}, cells[1].References)
+
+	cells = relation.GetCells(4)
+	require.Equal(t, []int{2, 4, 7}, cells[0].References)
+}
+
+func TestGetCellsIndexPages(t *testing.T) {
+	relation := Relation{
+		Name: "TestIndex",
+		Fsm:  []int16{0, 0, 0, 0},
+		IndexPages: []IndexPage{
+			{Type: PageTypeMeta},
+			{Type: "leaf", LiveItems: 10, DeadItems: 1, FreeSize: 1000},
+			{Type: "leaf", LiveItems: 20, FreeSize: 3000},
+			{Type: "internal", LiveItems: 2, FreeSize: 4000},
+		},
+	}
+	cells := relation.GetCells(2)
+	require.Equal(t, PageTypeMeta, cells[0].PageType)
+	require.Equal(t, "leaf", cells[1].PageType)
+	require.Equal(t, 22, cells[1].LiveItems)
+	require.Equal(t, 500, cells[0].AvgPageFree)
+	require.Equal(t, 3500, cells[1].AvgPageFree)
+
+	cells = relation.GetCells(4)
+	require.Equal(t, "leaf", cells[0].PageType)
+	require.Equal(t, 32, cells[0].LiveItems)
+	require.Equal(t, 1, cells[0].DeadItems)
+}
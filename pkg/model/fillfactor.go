@@ -0,0 +1,108 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/rotisserie/eris"
+)
+
+// MaxHeapTuplesPerPage is the maximum number of line pointers of a heap
+// page with the default block size
+const MaxHeapTuplesPerPage = 291
+
+// maxAlign rounds a tuple size up to the 8 bytes alignment of heap tuples
+func maxAlign(size int) int {
+	return (size + 7) &^ 7
+}
+
+// FillfactorSimulation compares a heap with its predicted layout after a
+// rewrite with another fillfactor
+type FillfactorSimulation struct {
+	Fillfactor int
+	Current    Relation
+	Predicted  Relation
+}
+
+// NewFillfactorSimulation packs the live tuples of the heap in block order,
+// like a rewrite with VACUUM FULL or CLUSTER does, keeping the space
+// reserved by the fillfactor free. Tuples of a block are assumed to have
+// the block's average size and dead tuples are dropped.
+func NewFillfactorSimulation(heap Relation, fillfactor int) (FillfactorSimulation, error) {
+	s := FillfactorSimulation{Fillfactor: fillfactor, Current: heap}
+	if fillfactor < 10 || fillfactor > 100 {
+		return s, eris.Errorf("Fillfactor %d is outside of the allowed range [10, 100]", fillfactor)
+	}
+	if heap.Tuples == nil {
+		return s, eris.Errorf("Tuples of '%s' are needed to simulate a rewrite", heap.Name)
+	}
+	saveFreeSpace := BlockSize * (100 - fillfactor) / 100
+	predicted := Relation{
+		Name:   fmt.Sprintf("%s with fillfactor %d", heap.Name, fillfactor),
+		Fsm:    make([]int16, 0),
+		Tuples: make([]TupleCount, 0),
+	}
+	// Space between the line pointers and the tuples of each page
+	free := make([]int, 0)
+	for _, t := range heap.Tuples {
+		for i := 0; i < t.Live; i++ {
+			size := t.LiveBytes / t.Live
+			if i < t.LiveBytes%t.Live {
+				size++
+			}
+			last := len(free) - 1
+			// Same check as raw_heap_insert, an empty page always takes
+			// the tuple
+			if last < 0 || (predicted.Tuples[last].Live > 0 &&
+				(maxAlign(size)+saveFreeSpace > free[last]-ItemIdSize ||
+					predicted.Tuples[last].Live >= MaxHeapTuplesPerPage)) {
+				predicted.Tuples = append(predicted.Tuples, TupleCount{})
+				free = append(free, BlockSize-PageHeaderSize)
+				last++
+			}
+			predicted.Tuples[last].Live++
+			predicted.Tuples[last].LiveBytes += size
+			free[last] -= maxAlign(size) + ItemIdSize
+		}
+	}
+	for _, pageFree := range free {
+		// The FSM stores the free space left for a new line pointer and
+		// tuple in 32 bytes categories
+		category := min(max(pageFree-ItemIdSize, 0)/32, 255)
+		predicted.Fsm = append(predicted.Fsm, int16(category*32))
+	}
+	s.Predicted = predicted
+	return s, nil
+}
+
+func getFreePercent(r Relation) float64 {
+	if r.GetNumbBuffers() == 0 {
+		return 0
+	}
+	free := 0
+	for _, avail := range r.Fsm {
+		free += int(avail)
+	}
+	return float64(free) * 100 / float64(r.GetNumbBuffers()*BlockSize)
+}
+
+// GetSummary describes the current and predicted sizes
+func (s *FillfactorSimulation) GetSummary() []string {
+	current := int64(s.Current.GetNumbBuffers()) * BlockSize
+	predicted := int64(s.Predicted.GetNumbBuffers()) * BlockSize
+	change := 0.0
+	if current > 0 {
+		change = float64(predicted-current) * 100 / float64(current)
+	}
+	live, dead := 0, 0
+	for _, t := range s.Current.Tuples {
+		live += t.Live
+		dead += t.Dead
+	}
+	return []string{
+		fmt.Sprintf("Current: %d blocks (%s), %.1f%% free, %d live and %d dead tuples",
+			s.Current.GetNumbBuffers(), FormatSize(current), getFreePercent(s.Current), live, dead),
+		fmt.Sprintf("Predicted with fillfactor %d: %d blocks (%s), %.1f%% free, %+.1f%% size",
+			s.Fillfactor, s.Predicted.GetNumbBuffers(), FormatSize(predicted),
+			getFreePercent(s.Predicted), change),
+	}
+}
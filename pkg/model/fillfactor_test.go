@@ -0,0 +1,38 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFillfactorSimulation(t *testing.T) {
+	heap := Relation{
+		Name: "heap",
+		Fsm:  []int16{0, 0, MaxFreeSpace},
+		Tuples: []TupleCount{
+			{Live: 40, Dead: 10, LiveBytes: 4000},
+			{Live: 40, LiveBytes: 4000},
+			{},
+		},
+	}
+	s, err := NewFillfactorSimulation(heap, 100)
+	require.NoError(t, err)
+	require.Equal(t, []TupleCount{{Live: 75, LiveBytes: 7500}, {Live: 5, LiveBytes: 500}}, s.Predicted.Tuples)
+	require.Equal(t, []int16{64, 7616}, s.Predicted.Fsm)
+
+	s, err = NewFillfactorSimulation(heap, 50)
+	require.NoError(t, err)
+	require.Equal(t, 3, s.Predicted.GetNumbBuffers())
+	require.Equal(t, 37, s.Predicted.Tuples[0].Live)
+	require.Equal(t, []string{
+		"Current: 3 blocks (24.0 kB), 33.2% free, 80 live and 10 dead tuples",
+		"Predicted with fillfactor 50: 3 blocks (24.0 kB), 64.3% free, +0.0% size",
+	}, s.GetSummary())
+
+	_, err = NewFillfactorSimulation(heap, 5)
+	require.Error(t, err)
+	heap.Tuples = nil
+	_, err = NewFillfactorSimulation(heap, 90)
+	require.Error(t, err)
+}
@@ -0,0 +1,366 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/rotisserie/eris"
+)
+
+// Layout of the FSM with the default block size, from freespace.c and
+// fsmpage.c
+const (
+	fsmCategories          = 256
+	fsmCatStep             = BlockSize / fsmCategories
+	fsmNodesPerPage        = BlockSize - PageHeaderSize - 4
+	fsmNonLeafNodesPerPage = BlockSize/2 - 1
+	fsmSlotsPerPage        = fsmNodesPerPage - fsmNonLeafNodesPerPage
+	fsmTreeDepth           = 3
+	fsmRootLevel           = fsmTreeDepth - 1
+	fsmMaxRestarts         = 10000
+)
+
+// fsmSpaceAvailToCat converts free bytes to the category stored in the FSM
+func fsmSpaceAvailToCat(avail int) uint8 {
+	if avail >= MaxFreeSpace {
+		return 255
+	}
+	return uint8(min(avail/fsmCatStep, 254))
+}
+
+// fsmSpaceNeededToCat converts a requested size to the lowest category
+// guaranteeing it
+func fsmSpaceNeededToCat(needed int) uint8 {
+	if needed == 0 {
+		return 1
+	}
+	return uint8(min((needed+fsmCatStep-1)/fsmCatStep, 255))
+}
+
+// fsmPage is the binary tree of categories stored in a FSM page, each
+// node holding the max of its children and the leaves the categories of
+// the slots
+type fsmPage struct {
+	nodes []uint8
+	// Slot where the next search starts, spreading inserts of concurrent
+	// backends
+	nextSlot int
+}
+
+func fsmParentOf(x int) int {
+	return (x - 1) / 2
+}
+
+func fsmLeftChild(x int) int {
+	return 2*x + 1
+}
+
+// fsmRightNeighbor returns the node at the right of x, wrapping around to
+// the leftmost node of the level
+func fsmRightNeighbor(x int) int {
+	x++
+	// The leftmost nodes of each level are numbered 2^level - 1
+	if ((x + 1) & x) == 0 {
+		x = fsmParentOf(x)
+	}
+	return x
+}
+
+func newFsmPage(slots []uint8) *fsmPage {
+	p := &fsmPage{nodes: make([]uint8, fsmNodesPerPage)}
+	copy(p.nodes[fsmNonLeafNodesPerPage:], slots)
+	for node := fsmNonLeafNodesPerPage - 1; node >= 0; node-- {
+		p.nodes[node] = p.getChildrenMax(node)
+	}
+	return p
+}
+
+func (p *fsmPage) getChildrenMax(node int) uint8 {
+	left := fsmLeftChild(node)
+	value := uint8(0)
+	if left < fsmNodesPerPage {
+		value = p.nodes[left]
+	}
+	if left+1 < fsmNodesPerPage {
+		value = max(value, p.nodes[left+1])
+	}
+	return value
+}
+
+// setAvail sets the category of a slot and updates its ancestors like
+// fsm_set_avail
+func (p *fsmPage) setAvail(slot int, value uint8) {
+	node := fsmNonLeafNodesPerPage + slot
+	if p.nodes[node] == value {
+		return
+	}
+	p.nodes[node] = value
+	for node > 0 {
+		node = fsmParentOf(node)
+		newValue := p.getChildrenMax(node)
+		if p.nodes[node] == newValue {
+			break
+		}
+		p.nodes[node] = newValue
+	}
+}
+
+// searchAvail returns a slot with at least minValue like fsm_search_avail,
+// or -1. The search climbs from the next slot towards the right so it
+// finds a slot close to the previous one, then descends preferring the
+// left child.
+func (p *fsmPage) searchAvail(minValue uint8, advanceNext bool) int {
+	if p.nodes[0] < minValue {
+		return -1
+	}
+	target := p.nextSlot
+	if target < 0 || target >= fsmSlotsPerPage {
+		target = 0
+	}
+	node := fsmNonLeafNodesPerPage + target
+	for node > 0 {
+		if p.nodes[node] >= minValue {
+			break
+		}
+		node = fsmParentOf(fsmRightNeighbor(node))
+	}
+	for node < fsmNonLeafNodesPerPage {
+		child := fsmLeftChild(node)
+		if child < fsmNodesPerPage && p.nodes[child] >= minValue {
+			node = child
+			continue
+		}
+		child++
+		if child < fsmNodesPerPage && p.nodes[child] >= minValue {
+			node = child
+			continue
+		}
+		// The tree is built consistent, a parent always has a child
+		// with its value
+		return -1
+	}
+	slot := node - fsmNonLeafNodesPerPage
+	p.nextSlot = slot
+	if advanceNext {
+		p.nextSlot++
+	}
+	return slot
+}
+
+type fsmAddress struct {
+	level int
+	page  int
+}
+
+// FreeSpaceMap mimics PostgreSQL's free space map of a relation: a tree of
+// FSM pages whose bottom level holds the category of each heap block and
+// upper levels the max category of their child pages. Like PostgreSQL,
+// updates of a bottom page aren't propagated to upper levels until a
+// search finds them out of date.
+type FreeSpaceMap struct {
+	pages map[fsmAddress]*fsmPage
+}
+
+// NewFreeSpaceMap builds the FSM from the free bytes of each block reported
+// by pg_freespace
+func NewFreeSpaceMap(fsm []int16) FreeSpaceMap {
+	m := FreeSpaceMap{pages: make(map[fsmAddress]*fsmPage)}
+	categories := make([]uint8, len(fsm))
+	for i, avail := range fsm {
+		categories[i] = fsmSpaceAvailToCat(int(avail))
+	}
+	for level := 0; level < fsmTreeDepth; level++ {
+		upper := make([]uint8, 0)
+		for page := 0; page == 0 || page*fsmSlotsPerPage < len(categories); page++ {
+			end := min((page+1)*fsmSlotsPerPage, len(categories))
+			p := newFsmPage(categories[min(page*fsmSlotsPerPage, end):end])
+			m.pages[fsmAddress{level, page}] = p
+			upper = append(upper, p.nodes[0])
+		}
+		categories = upper
+	}
+	return m
+}
+
+// search walks down the tree to a heap block with at least minCat like
+// fsm_search, or returns -1
+func (m *FreeSpaceMap) search(minCat uint8) int {
+	addr := fsmAddress{fsmRootLevel, 0}
+	for restarts := 0; restarts < fsmMaxRestarts; {
+		slot := -1
+		maxAvail := uint8(0)
+		page, ok := m.pages[addr]
+		if ok {
+			slot = page.searchAvail(minCat, addr.level == 0)
+			maxAvail = page.nodes[0]
+		}
+		if slot != -1 {
+			if addr.level == 0 {
+				return addr.page*fsmSlotsPerPage + slot
+			}
+			addr = fsmAddress{addr.level - 1, addr.page*fsmSlotsPerPage + slot}
+		} else if addr.level == fsmRootLevel {
+			return -1
+		} else {
+			// The parent was out of date, fix it and restart from the root
+			parent := fsmAddress{addr.level + 1, addr.page / fsmSlotsPerPage}
+			m.pages[parent].setAvail(addr.page%fsmSlotsPerPage, maxAvail)
+			addr = fsmAddress{fsmRootLevel, 0}
+			restarts++
+		}
+	}
+	return -1
+}
+
+// GetPageWithFreeSpace returns a block with at least spaceNeeded bytes
+// free according to the FSM, or -1
+func (m *FreeSpaceMap) GetPageWithFreeSpace(spaceNeeded int) int {
+	return m.search(fsmSpaceNeededToCat(spaceNeeded))
+}
+
+// RecordAndGetPageWithFreeSpace records the actual free space of a block
+// that was too full, then looks for another block, first in the same FSM
+// page
+func (m *FreeSpaceMap) RecordAndGetPageWithFreeSpace(oldBlock int, oldSpaceAvail int, spaceNeeded int) int {
+	searchCat := fsmSpaceNeededToCat(spaceNeeded)
+	addr := fsmAddress{0, oldBlock / fsmSlotsPerPage}
+	page := m.pages[addr]
+	page.setAvail(oldBlock%fsmSlotsPerPage, fsmSpaceAvailToCat(oldSpaceAvail))
+	if slot := page.searchAvail(searchCat, true); slot != -1 {
+		return addr.page*fsmSlotsPerPage + slot
+	}
+	return m.search(searchCat)
+}
+
+// InsertSimulation is the outcome of inserting tuples of the same size in
+// a heap until it has to be extended
+type InsertSimulation struct {
+	TupleSize  int
+	Fillfactor int
+	// Block receiving the next insert, -1 when it extends the relation
+	Target int
+	// Number of inserts landing in each block
+	Inserts             []int
+	InsertsBeforeExtend int
+}
+
+// getPageFreeSpace returns the free space of a heap block like
+// PageGetFreeSpace from its page header, and its number of line pointers.
+// The FSM value is used when the page header wasn't fetched.
+func (r *Relation) getPageFreeSpace(block int) (free int, linePointers int) {
+	space, ok := r.PageSpace[block]
+	if !ok {
+		return int(r.Fsm[block]), 0
+	}
+	return space.GetFreeSpace(), space.GetNumLinePointers()
+}
+
+// getInsertSpace returns the aligned length of inserted tuples and the
+// free space RelationGetBufferForTuple requests for them
+func getInsertSpace(tupleSize int, fillfactor int) (length int, targetFreeSpace int, err error) {
+	if tupleSize <= 0 || tupleSize > MaxFreeSpace {
+		return 0, 0, eris.Errorf("Tuple size %d is outside of the allowed range [1, %d]", tupleSize, MaxFreeSpace)
+	}
+	if fillfactor < 10 || fillfactor > 100 {
+		return 0, 0, eris.Errorf("Fillfactor %d is outside of the allowed range [10, 100]", fillfactor)
+	}
+	length = maxAlign(tupleSize)
+	saveFreeSpace := BlockSize * (100 - fillfactor) / 100
+	targetFreeSpace = length + saveFreeSpace
+	nearlyEmptyFreeSpace := MaxFreeSpace - MaxHeapTuplesPerPage/8*ItemIdSize
+	if targetFreeSpace > nearlyEmptyFreeSpace {
+		targetFreeSpace = max(length, nearlyEmptyFreeSpace)
+	}
+	return length, targetFreeSpace, nil
+}
+
+// GetInsertCandidates returns the blocks the insert simulation can pick:
+// the ones with enough free space in the FSM, and the last block tried
+// before extending. Only their page headers are needed.
+func (r *Relation) GetInsertCandidates(tupleSize int, fillfactor int) ([]int, error) {
+	_, targetFreeSpace, err := getInsertSpace(tupleSize, fillfactor)
+	if err != nil {
+		return nil, err
+	}
+	minCat := fsmSpaceNeededToCat(targetFreeSpace)
+	candidates := make([]int, 0)
+	numBlocks := r.GetNumbBuffers()
+	for block := 0; block < numBlocks; block++ {
+		if fsmSpaceAvailToCat(int(r.Fsm[block])) >= minCat || block == numBlocks-1 {
+			candidates = append(candidates, block)
+		}
+	}
+	return candidates, nil
+}
+
+// SimulateInserts follows RelationGetBufferForTuple for a new backend
+// inserting tuples of tupleSize bytes. Blocks are picked from the FSM
+// while their actual free space decides whether the tuple fits, they
+// differ until VACUUM updates the FSM. The FSM pages' fp_next_slot isn't
+// visible from SQL, searches are assumed to start from the first slot of
+// each FSM page while the server starts after the slot returned last.
+func SimulateInserts(heap Relation, tupleSize int, fillfactor int) (InsertSimulation, error) {
+	s := InsertSimulation{TupleSize: tupleSize, Fillfactor: fillfactor, Target: -1,
+		Inserts: make([]int, heap.GetNumbBuffers())}
+	length, targetFreeSpace, err := getInsertSpace(tupleSize, fillfactor)
+	if err != nil {
+		return s, err
+	}
+	itemSize := length + ItemIdSize
+
+	numBlocks := heap.GetNumbBuffers()
+	free := make([]int, numBlocks)
+	linePointers := make([]int, numBlocks)
+	for block := range free {
+		free[block], linePointers[block] = heap.getPageFreeSpace(block)
+	}
+	fsm := NewFreeSpaceMap(heap.Fsm)
+	target := fsm.GetPageWithFreeSpace(targetFreeSpace)
+	// Without candidate in the FSM, the last block is tried before
+	// extending
+	if target < 0 && numBlocks > 0 {
+		target = numBlocks - 1
+	}
+	for target >= 0 {
+		pageFreeSpace := free[target]
+		if linePointers[target] >= MaxHeapTuplesPerPage {
+			pageFreeSpace = 0
+		}
+		if targetFreeSpace <= pageFreeSpace {
+			if s.InsertsBeforeExtend == 0 {
+				s.Target = target
+			}
+			// Fill the block until the tuple or its line pointer doesn't fit
+			inserts := (pageFreeSpace-targetFreeSpace)/itemSize + 1
+			inserts = min(inserts, MaxHeapTuplesPerPage-linePointers[target])
+			free[target] = max(free[target]-inserts*itemSize, 0)
+			linePointers[target] += inserts
+			s.Inserts[target] += inserts
+			s.InsertsBeforeExtend += inserts
+			continue
+		}
+		target = fsm.RecordAndGetPageWithFreeSpace(target, pageFreeSpace, targetFreeSpace)
+	}
+	return s, nil
+}
+
+// GetLabel describes the simulation for the legend
+func (s *InsertSimulation) GetLabel() string {
+	target := "extends the relation"
+	if s.Target >= 0 {
+		target = fmt.Sprintf("lands in block %d", s.Target)
+	}
+	return fmt.Sprintf("Next insert of %d B %s assuming FSM searches from the first slot, inserts before extension",
+		s.TupleSize, target)
+}
+
+// HighlightInserts highlights the blocks receiving the simulated inserts
+// in the table's heap
+func (t *Table) HighlightInserts(tupleSize int, fillfactor int) (InsertSimulation, error) {
+	s, err := SimulateInserts(t.Relation, tupleSize, fillfactor)
+	if err != nil {
+		return s, err
+	}
+	t.Highlight = s.Inserts
+	t.HighlightLabel = s.GetLabel()
+	return s, nil
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreeSpaceMapSearch(t *testing.T) {
+	fsm := NewFreeSpaceMap([]int16{0, 0, MaxFreeSpace, 3200, 0})
+	require.Equal(t, 2, fsm.GetPageWithFreeSpace(100))
+	// The search continues after the previous slot
+	require.Equal(t, 3, fsm.GetPageWithFreeSpace(100))
+	// and wraps around
+	require.Equal(t, 2, fsm.GetPageWithFreeSpace(MaxFreeSpace))
+
+	// A full block is recorded and the next candidate returned
+	require.Equal(t, 3, fsm.RecordAndGetPageWithFreeSpace(2, 0, 3000))
+	require.Equal(t, -1, fsm.RecordAndGetPageWithFreeSpace(3, 100, 3000))
+}
+
+func TestSimulateInserts(t *testing.T) {
+	heap := Relation{Fsm: []int16{0, 320, 0}}
+	s, err := SimulateInserts(heap, 100, 100)
+	require.NoError(t, err)
+	require.Equal(t, 1, s.Target)
+	require.Equal(t, 3, s.InsertsBeforeExtend)
+	require.Equal(t, []int{0, 3, 0}, s.Inserts)
+
+	// The fillfactor reserves space, the FSM has no candidate and the last
+	// block is full
+	s, err = SimulateInserts(heap, 100, 90)
+	require.NoError(t, err)
+	require.Equal(t, -1, s.Target)
+	require.Equal(t, 0, s.InsertsBeforeExtend)
+
+	// Without candidate in the FSM, the last block is tried. Its free
+	// space not yet recorded in the FSM is used.
+	heap.PageSpace = map[int]PageSpace{0: {Lower: 344, Upper: 352}, 1: {}, 2: {Lower: 104, Upper: 6192}}
+	s, err = SimulateInserts(heap, 100, 90)
+	require.NoError(t, err)
+	require.Equal(t, 2, s.Target)
+	// 6192 - 104 - 4 bytes with 819 reserved by the fillfactor
+	require.Equal(t, []int{0, 0, 48}, s.Inserts)
+
+	require.Equal(t, 4, heap.PageSpace[0].GetFreeSpace())
+	require.Equal(t, BlockSize-PageHeaderSize-ItemIdSize, heap.PageSpace[1].GetFreeSpace())
+	require.Equal(t, 20, heap.PageSpace[2].GetNumLinePointers())
+
+	_, err = SimulateInserts(heap, 0, 100)
+	require.Error(t, err)
+
+	// Small tuples are limited by the number of line pointers
+	empty := Relation{Fsm: []int16{MaxFreeSpace}, PageSpace: map[int]PageSpace{0: {}}}
+	s, err = SimulateInserts(empty, 1, 100)
+	require.NoError(t, err)
+	require.Equal(t, []int{MaxHeapTuplesPerPage}, s.Inserts)
+}
+
+func TestInsertCandidates(t *testing.T) {
+	heap := Relation{Fsm: []int16{0, 320, 96, 0, 0}}
+	candidates, err := heap.GetInsertCandidates(100, 100)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 4}, candidates)
+
+	candidates, err = heap.GetInsertCandidates(50, 100)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 4}, candidates)
+
+	_, err = heap.GetInsertCandidates(100, 5)
+	require.Error(t, err)
+}
+
+func TestSimulateInsertsMultipleFsmPages(t *testing.T) {
+	heap := Relation{Fsm: make([]int16, 3*fsmSlotsPerPage)}
+	heap.Fsm[fsmSlotsPerPage+10] = 1024
+	heap.Fsm[2*fsmSlotsPerPage+5] = 512
+	table := Table{Relation: heap}
+	s, err := table.HighlightInserts(200, 100)
+	require.NoError(t, err)
+	require.Equal(t, fsmSlotsPerPage+10, s.Target)
+	// 1024 then 512 bytes hold 5 and 2 tuples of 200 bytes with their
+	// line pointer
+	require.Equal(t, 7, s.InsertsBeforeExtend)
+	require.Equal(t, 5, table.Highlight[fsmSlotsPerPage+10])
+	require.Equal(t, 2, table.Highlight[2*fsmSlotsPerPage+5])
+	require.Equal(t, "Next insert of 200 B lands in block 4079 assuming FSM searches from the first slot, inserts before extension", table.HighlightLabel)
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Page types of GIN indexes
+const (
+	PageTypeGinEntryInternal   = "gin-entry-internal"
+	PageTypeGinEntryLeaf       = "gin-entry-leaf"
+	PageTypeGinPostingInternal = "gin-posting-internal"
+	PageTypeGinPostingLeaf     = "gin-posting-leaf"
+	PageTypeGinPending         = "gin-pending"
+)
+
+// GinMeta is the metapage of a GIN index as returned by gin_metapage_info
+type GinMeta struct {
+	PendingPages  int64
+	PendingTuples int64
+	TotalPages    int64
+	EntryPages    int64
+	DataPages     int64
+	Entries       int64
+}
+
+// GetGinPageType returns the type of a GIN page from the flags returned by
+// gin_page_opaque_info
+func GetGinPageType(flags []string) string {
+	switch {
+	case slices.Contains(flags, "meta"):
+		return PageTypeMeta
+	case slices.Contains(flags, "deleted"):
+		return PageTypeDeleted
+	case slices.Contains(flags, "list"):
+		return PageTypeGinPending
+	case slices.Contains(flags, "data") && slices.Contains(flags, "leaf"):
+		return PageTypeGinPostingLeaf
+	case slices.Contains(flags, "data"):
+		return PageTypeGinPostingInternal
+	case slices.Contains(flags, "leaf"):
+		return PageTypeGinEntryLeaf
+	}
+	return PageTypeGinEntryInternal
+}
+
+func (m *GinMeta) GetSummary() string {
+	return fmt.Sprintf("pending list %d pages (%d tuples), %d entry pages, %d posting tree pages, %d entries",
+		m.PendingPages, m.PendingTuples, m.EntryPages, m.DataPages, m.Entries)
+}
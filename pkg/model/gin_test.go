@@ -0,0 +1,25 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGinPageType(t *testing.T) {
+	testCases := []struct {
+		flags            []string
+		expectedPageType string
+	}{
+		{[]string{"meta"}, PageTypeMeta},
+		{[]string{"leaf", "deleted"}, PageTypeDeleted},
+		{[]string{"list", "list_fullrow"}, PageTypeGinPending},
+		{[]string{"data", "leaf", "compressed"}, PageTypeGinPostingLeaf},
+		{[]string{"data"}, PageTypeGinPostingInternal},
+		{[]string{"leaf"}, PageTypeGinEntryLeaf},
+		{[]string{}, PageTypeGinEntryInternal},
+	}
+	for _, tC := range testCases {
+		require.Equal(t, tC.expectedPageType, GetGinPageType(tC.flags), "flags %v", tC.flags)
+	}
+}
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+
+	"github.com/rotisserie/eris"
+)
+
+// Page types of GiST and SP-GiST indexes
+const (
+	PageTypeGistInternal   = "gist-internal"
+	PageTypeGistLeaf       = "gist-leaf"
+	PageTypeSpgistInternal = "spgist-internal"
+	PageTypeSpgistLeaf     = "spgist-leaf"
+)
+
+// Flags of the SP-GiST special space
+const (
+	spgistMeta    = 1 << 0
+	spgistDeleted = 1 << 1
+	spgistLeaf    = 1 << 2
+	spgistNulls   = 1 << 3
+	// Size of SpGistPageOpaqueData
+	SpgistSpecialSize = 8
+	// spgist_page_id ending the special space of initialized pages
+	spgistPageId = 0xFF82
+)
+
+// GetGistPageType returns the type of a GiST page from the flags returned
+// by gist_page_opaque_info
+func GetGistPageType(flags []string) string {
+	switch {
+	case slices.Contains(flags, "deleted"):
+		return PageTypeDeleted
+	case slices.Contains(flags, "leaf"):
+		return PageTypeGistLeaf
+	}
+	return PageTypeGistInternal
+}
+
+// NewSpgistPage decodes the special space of a SP-GiST page, stored in
+// the server's byte order, assumed little endian. numItems is the number of
+// line pointers of the page. New zeroed pages, without the SP-GiST page
+// id, are unused.
+func NewSpgistPage(special []byte, numItems int, freeSize int) (IndexPage, error) {
+	page := IndexPage{Next: -1, FreeSize: freeSize, Flags: make([]string, 0)}
+	if len(special) < SpgistSpecialSize {
+		return page, eris.Errorf("SP-GiST special space has %d bytes, expected %d", len(special), SpgistSpecialSize)
+	}
+	flags := binary.LittleEndian.Uint16(special[0:2])
+	numRedirections := int(binary.LittleEndian.Uint16(special[2:4]))
+	numPlaceholders := int(binary.LittleEndian.Uint16(special[4:6]))
+	pageId := binary.LittleEndian.Uint16(special[6:8])
+	switch {
+	case pageId != spgistPageId:
+		page.Type = PageTypeUnused
+	case flags&spgistMeta != 0:
+		page.Type = PageTypeMeta
+	case flags&spgistDeleted != 0:
+		page.Type = PageTypeDeleted
+	case flags&spgistLeaf != 0:
+		page.Type = PageTypeSpgistLeaf
+	default:
+		page.Type = PageTypeSpgistInternal
+	}
+	if page.Type == PageTypeMeta || page.Type == PageTypeDeleted || page.Type == PageTypeUnused {
+		return page, nil
+	}
+	if flags&spgistNulls != 0 {
+		page.Flags = append(page.Flags, "nulls")
+	}
+	if numRedirections > 0 {
+		page.Flags = append(page.Flags, fmt.Sprintf("%d redirections", numRedirections))
+	}
+	if numPlaceholders > 0 {
+		page.Flags = append(page.Flags, fmt.Sprintf("%d placeholders", numPlaceholders))
+	}
+	page.LiveItems = max(0, numItems-numRedirections-numPlaceholders)
+	page.DeadItems = numRedirections + numPlaceholders
+	return page, nil
+}
+
+// GetPageTypeSummary counts the pages of each type with the items of the
+// index
+func GetPageTypeSummary(pages []IndexPage) string {
+	counts := make(map[string]int)
+	types := make([]string, 0)
+	liveItems, deadItems := 0, 0
+	for _, page := range pages {
+		if counts[page.Type] == 0 {
+			types = append(types, page.Type)
+		}
+		counts[page.Type]++
+		liveItems += page.LiveItems
+		deadItems += page.DeadItems
+	}
+	summary := ""
+	for _, t := range types {
+		summary += fmt.Sprintf("%d %s pages, ", counts[t], t)
+	}
+	return summary + fmt.Sprintf("%d live items, %d dead", liveItems, deadItems)
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGistPageType(t *testing.T) {
+	require.Equal(t, PageTypeGistLeaf, GetGistPageType([]string{"leaf", "follow_right"}))
+	require.Equal(t, PageTypeGistInternal, GetGistPageType([]string{}))
+	require.Equal(t, PageTypeDeleted, GetGistPageType([]string{"leaf", "deleted"}))
+}
+
+func TestSpgistPage(t *testing.T) {
+	// Leaf on the nulls tree with 1 redirection and 2 placeholders
+	page, err := NewSpgistPage([]byte{0x0c, 0, 1, 0, 2, 0, 0x82, 0xff}, 10, 100)
+	require.NoError(t, err)
+	require.Equal(t, PageTypeSpgistLeaf, page.Type)
+	require.Equal(t, 7, page.LiveItems)
+	require.Equal(t, 3, page.DeadItems)
+	require.Equal(t, []string{"nulls", "1 redirections", "2 placeholders"}, page.Flags)
+
+	meta, err := NewSpgistPage([]byte{1, 0, 0, 0, 0, 0, 0x82, 0xff}, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, PageTypeMeta, meta.Type)
+
+	// The special space of a zeroed page is the start of the page
+	zeroed, err := NewSpgistPage(make([]byte, SpgistSpecialSize), 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, PageTypeUnused, zeroed.Type)
+
+	_, err = NewSpgistPage([]byte{1}, 0, 0)
+	require.Error(t, err)
+}
+
+func TestPageTypeSummary(t *testing.T) {
+	pages := []IndexPage{
+		{Type: PageTypeGistInternal, LiveItems: 2},
+		{Type: PageTypeGistLeaf, LiveItems: 10, DeadItems: 1},
+		{Type: PageTypeGistLeaf, LiveItems: 20},
+	}
+	require.Equal(t, "1 gist-internal pages, 2 gist-leaf pages, 32 live items, 1 dead", GetPageTypeSummary(pages))
+}
@@ -0,0 +1,97 @@
+package model
+
+import "fmt"
+
+// Page types of hash indexes
+const (
+	PageTypeHashBucket   = "hash-bucket"
+	PageTypeHashOverflow = "hash-overflow"
+	PageTypeHashBitmap   = "hash-bitmap"
+)
+
+// hashPageFlags are the flags of hasho_flag not implied by the page type
+var hashPageFlags = []struct {
+	mask int
+	name string
+}{
+	{1 << 4, "being_populated"},
+	{1 << 5, "being_split"},
+	{1 << 6, "needs_split_cleanup"},
+	{1 << 7, "has_dead_tuples"},
+}
+
+// HashMeta is the metapage of a hash index as returned by hash_metapage_info
+type HashMeta struct {
+	Tuples int64
+	// Target number of tuples per bucket, derived from the fillfactor and
+	// the item size
+	TargetTuples int
+	MaxBucket    int
+}
+
+// GetHashPageType converts a type returned by hash_page_type
+func GetHashPageType(hashPageType string) string {
+	switch hashPageType {
+	case "metapage":
+		return PageTypeMeta
+	case "bucket":
+		return PageTypeHashBucket
+	case "overflow":
+		return PageTypeHashOverflow
+	case "bitmap":
+		return PageTypeHashBitmap
+	}
+	return PageTypeUnused
+}
+
+// GetHashPageFlags returns the names of the flags set in hasho_flag
+func GetHashPageFlags(flag int) []string {
+	flags := make([]string, 0)
+	for _, f := range hashPageFlags {
+		if flag&f.mask != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+	return flags
+}
+
+// GetHashChainLengths returns the number of overflow pages chained to each
+// bucket page
+func GetHashChainLengths(pages []IndexPage) []int {
+	lengths := make([]int, 0)
+	for _, page := range pages {
+		if page.Type != PageTypeHashBucket {
+			continue
+		}
+		length := 0
+		seen := make(map[int]bool)
+		for next := page.Next; next >= 0 && next < len(pages) && !seen[next]; next = pages[next].Next {
+			seen[next] = true
+			length++
+		}
+		lengths = append(lengths, length)
+	}
+	return lengths
+}
+
+// GetHashSummary describes the buckets and overflow chains of a hash index
+func GetHashSummary(meta HashMeta, pages []IndexPage) string {
+	lengths := GetHashChainLengths(pages)
+	numOverflow, longest := 0, 0
+	for _, length := range lengths {
+		numOverflow += length
+		longest = max(longest, length)
+	}
+	numUnused := 0
+	for _, page := range pages {
+		if page.Type == PageTypeUnused {
+			numUnused++
+		}
+	}
+	averageChain := 0.0
+	if len(lengths) > 0 {
+		averageChain = float64(numOverflow) / float64(len(lengths))
+	}
+	return fmt.Sprintf("%d tuples in %d buckets (target %d tuples per bucket), %d chained overflow pages, %.2f per bucket, longest chain %d, %d unused pages",
+		meta.Tuples, meta.MaxBucket+1, meta.TargetTuples, numOverflow, averageChain, longest, numUnused)
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashChains(t *testing.T) {
+	pages := []IndexPage{
+		{Type: PageTypeMeta, Next: -1},
+		{Type: PageTypeHashBucket, Next: 3},
+		{Type: PageTypeHashBucket, Next: -1},
+		{Type: PageTypeHashOverflow, Next: 4},
+		{Type: PageTypeHashOverflow, Next: -1},
+		{Type: PageTypeUnused, Next: -1},
+	}
+	require.Equal(t, []int{2, 0}, GetHashChainLengths(pages))
+	require.Equal(t, "100 tuples in 2 buckets (target 307 tuples per bucket), 2 chained overflow pages, 1.00 per bucket, longest chain 2, 1 unused pages",
+		GetHashSummary(HashMeta{Tuples: 100, TargetTuples: 307, MaxBucket: 1}, pages))
+	require.Equal(t, []string{"being_split", "has_dead_tuples"}, GetHashPageFlags(2|1<<5|1<<7))
+	require.Equal(t, PageTypeHashBitmap, GetHashPageType("bitmap"))
+}
@@ -0,0 +1,51 @@
+package model
+
+// Page types of index pages, the access method specific ones are defined
+// with their access method
+const (
+	PageTypeMeta    = "meta"
+	PageTypeDeleted = "deleted"
+	PageTypeUnused  = "unused"
+)
+
+// IndexPage describes a page of an index as seen by its access method
+type IndexPage struct {
+	Type      string
+	LiveItems int
+	DeadItems int
+	// Free space between the line pointers and the items
+	FreeSize int
+	// Block linked from the page, like the next overflow page of a hash
+	// bucket, -1 when there's none
+	Next int
+	// Access method specific flags
+	Flags []string
+}
+
+// getPageType returns the most frequent page type of the blocks [start, end)
+func (r *Relation) getPageType(start int, end int) string {
+	counts := make(map[string]int)
+	pageType := ""
+	for block := start; block < end && block < len(r.IndexPages); block++ {
+		t := r.IndexPages[block].Type
+		counts[t]++
+		if counts[t] > counts[pageType] {
+			pageType = t
+		}
+	}
+	return pageType
+}
+
+// getAvgPageFree returns the average free space of the index pages of the
+// blocks [start, end)
+func (r *Relation) getAvgPageFree(start int, end int) int {
+	end = min(end, len(r.IndexPages))
+	if start >= end {
+		return 0
+	}
+	total := 0
+	for _, page := range r.IndexPages[start:end] {
+		total += page.FreeSize
+	}
+	return total / (end - start)
+}
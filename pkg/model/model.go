@@ -1,16 +1,64 @@
 package model
 
-import "math"
+import "fmt"
+
+// BlockSize is the default size of a PostgreSQL block
+const BlockSize = 8192
+
+// BlocksPerSegment is the number of 8kB blocks stored in a 1GB segment file
+const BlocksPerSegment = 131072
 
 type Relation struct {
 	Name string
-	Fsm  []int16
+	Oid  uint32
+	// Name as returned by regclass, quoted and schema qualified when needed
+	QualifiedName string
+	// Access method of an index, empty for heap
+	AccessMethod string
+	// Name of the heap an index points to, empty for heap
+	Heap string
+	// Path of the relation's first segment file relative to the data directory
+	Filepath string
+	Fsm      []int16
+
+	// Optional per-block information, nil when not fetched
+	Cached     []bool
+	AllVisible []bool
+	AllFrozen  []bool
+	Tuples     []TupleCount
+	// Free space bounds of the heap blocks inserts can land in by block,
+	// read by the insert simulation
+	PageSpace map[int]PageSpace
+	// Number of highlighted items per block, like rows matching a query
+	Highlight []int
+	// Sorted heap blocks referenced by each block of an index, nil for
+	// blocks without heap pointers like internal pages
+	HeapReferences [][]int
+	// Block ranges of the BRIN indexes on a heap
+	Brin []BrinSummary
+	// Pages of an index described by its access method
+	IndexPages []IndexPage
+	// Access method specific statistics, like the size of a GIN pending list
+	Summary string
+	// Statistics from pgstattuple for heap and pgstatindex for btree
+	TupleStats *TupleStats
+	IndexStats *IndexStats
+}
+
+// TupleCount is the number of tuples stored in a heap block
+type TupleCount struct {
+	Live int
+	Dead int
+	// Size of the live tuples, including their header
+	LiveBytes int
 }
 
 type Table struct {
 	Relation
 	Indexes []Relation
 	Toast   *Toast
+	// Meaning of the relations' highlighted blocks
+	HighlightLabel string
 }
 
 type Toast struct {
@@ -19,13 +67,57 @@ type Toast struct {
 }
 
 func (r *Relation) GetRelationSize() Size {
-	numBuffers := len(r.Fsm)
-	width := math.Ceil(math.Sqrt(float64(numBuffers)))
-	height := math.Ceil(float64(numBuffers) / width)
+	return GetGridSize(len(r.Fsm))
+}
 
-	return Size{int(width), int(height)}
+// GetSegmentName returns the file name of the given segment
+func (r *Relation) GetSegmentName(segment int) string {
+	if r.Filepath == "" {
+		return fmt.Sprintf("segment %d", segment)
+	}
+	if segment == 0 {
+		return r.Filepath
+	}
+	return fmt.Sprintf("%s.%d", r.Filepath, segment)
 }
 
 func (r *Relation) GetNumbBuffers() int {
 	return len(r.Fsm)
 }
+
+// GetNumBuffers returns the number of blocks of all relations of the table
+func (t *Table) GetNumBuffers() int {
+	numBuffers := t.GetNumbBuffers()
+	for _, index := range t.Indexes {
+		numBuffers += index.GetNumbBuffers()
+	}
+	if t.Toast != nil {
+		numBuffers += t.Toast.GetNumbBuffers() + t.Toast.Index.GetNumbBuffers()
+	}
+	return numBuffers
+}
+
+// GetRelations returns the table's relation, indexes and toast relations
+func (t *Table) GetRelations() []*Relation {
+	relations := []*Relation{&t.Relation}
+	for i := range t.Indexes {
+		relations = append(relations, &t.Indexes[i])
+	}
+	if t.Toast != nil {
+		relations = append(relations, &t.Toast.Relation, &t.Toast.Index)
+	}
+	return relations
+}
+
+// GetHighlightCount returns the number of highlighted items and blocks
+func (t *Table) GetHighlightCount() (items int, blocks int) {
+	for _, relation := range t.GetRelations() {
+		for _, count := range relation.Highlight {
+			items += count
+			if count > 0 {
+				blocks++
+			}
+		}
+	}
+	return items, blocks
+}
@@ -0,0 +1,153 @@
+package model
+
+// Line pointer flags
+const (
+	LpUnused   = 0
+	LpNormal   = 1
+	LpRedirect = 2
+	LpDead     = 3
+)
+
+// Tuple header flags from htup_details.h, t_infomask then t_infomask2
+const (
+	HeapHasNull       = 0x0001
+	HeapHasVarWidth   = 0x0002
+	HeapXmaxLockOnly  = 0x0080
+	HeapXminCommitted = 0x0100
+	HeapXminInvalid   = 0x0200
+	HeapXmaxCommitted = 0x0400
+	HeapXmaxInvalid   = 0x0800
+	HeapUpdated       = 0x2000
+
+	HeapNattsMask  = 0x07FF
+	HeapHotUpdated = 0x4000
+	HeapOnlyTuple  = 0x8000
+)
+
+// Sizes of page structures
+const (
+	PageHeaderSize      = 24
+	ItemIdSize          = 4
+	HeapTupleHeaderSize = 23
+)
+
+// PageHeader is the header of a page as returned by pageinspect's page_header
+type PageHeader struct {
+	Lsn      string
+	Checksum int
+	Flags    int
+	Lower    int
+	Upper    int
+	Special  int
+	PageSize int
+	Version  int
+	PruneXid int64
+}
+
+// PageSpace holds the bounds of a page's free space from its header
+type PageSpace struct {
+	Lower int
+	Upper int
+}
+
+// GetFreeSpace returns the free space like PageGetFreeSpace: the space
+// between the line pointers and the tuples, minus a new line pointer. New
+// pages are initialized before use and count as empty.
+func (p PageSpace) GetFreeSpace() int {
+	if p.Upper == 0 {
+		return BlockSize - PageHeaderSize - ItemIdSize
+	}
+	return max(p.Upper-p.Lower-ItemIdSize, 0)
+}
+
+// GetNumLinePointers returns the number of line pointers of the page
+func (p PageSpace) GetNumLinePointers() int {
+	return max(p.Lower-PageHeaderSize, 0) / ItemIdSize
+}
+
+// HeapItem is a line pointer of a heap page with its tuple header
+type HeapItem struct {
+	Lp      int
+	LpOff   int
+	LpFlags int
+	LpLen   int
+
+	// Tuple header, only set when HasTuple is true
+	HasTuple   bool
+	Xmin       int64
+	Xmax       int64
+	CtidBlock  int64
+	CtidOffset int
+	Infomask2  int
+	Infomask   int
+	Hoff       int
+	Bits       string
+}
+
+// Page is the content of a single block
+type Page struct {
+	Relation string
+	Block    int
+	Header   PageHeader
+	// Items are only fetched for heap pages
+	Items []HeapItem
+}
+
+var lpFlagNames = []string{"unused", "normal", "redirect", "dead"}
+
+func (i *HeapItem) GetLpFlagName() string {
+	if i.LpFlags < 0 || i.LpFlags >= len(lpFlagNames) {
+		return "unknown"
+	}
+	return lpFlagNames[i.LpFlags]
+}
+
+// GetInfomaskFlags returns the names of the tuple header flags set
+func (i *HeapItem) GetInfomaskFlags() []string {
+	flags := make([]string, 0)
+	if !i.HasTuple {
+		return flags
+	}
+	infomaskFlags := []struct {
+		mask int
+		name string
+	}{
+		{HeapHasNull, "HASNULL"},
+		{HeapHasVarWidth, "HASVARWIDTH"},
+		{HeapXmaxLockOnly, "XMAX_LOCK_ONLY"},
+		{HeapXminCommitted, "XMIN_COMMITTED"},
+		{HeapXminInvalid, "XMIN_INVALID"},
+		{HeapXmaxCommitted, "XMAX_COMMITTED"},
+		{HeapXmaxInvalid, "XMAX_INVALID"},
+		{HeapUpdated, "UPDATED"},
+	}
+	for _, f := range infomaskFlags {
+		if i.Infomask&f.mask != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+	if i.IsHotUpdated() {
+		flags = append(flags, "HOT_UPDATED")
+	}
+	if i.IsHeapOnly() {
+		flags = append(flags, "HEAP_ONLY")
+	}
+	return flags
+}
+
+func (i *HeapItem) IsHotUpdated() bool {
+	return i.HasTuple && i.Infomask2&HeapHotUpdated != 0
+}
+
+func (i *HeapItem) IsHeapOnly() bool {
+	return i.HasTuple && i.Infomask2&HeapOnlyTuple != 0
+}
+
+// IsDead returns whether the tuple is dead, based on the line pointer and
+// the hint bits
+func (i *HeapItem) IsDead() bool {
+	if i.LpFlags == LpDead {
+		return true
+	}
+	return i.HasTuple && i.Infomask&HeapXmaxCommitted != 0 && i.Infomask&HeapXmaxLockOnly == 0
+}
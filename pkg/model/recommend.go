@@ -0,0 +1,297 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Maintenance actions that can be recommended
+const (
+	ActionVacuum         = "VACUUM"
+	ActionVacuumFull     = "VACUUM FULL / pg_repack"
+	ActionReindex        = "REINDEX CONCURRENTLY"
+	ActionFillfactor     = "Lower fillfactor"
+	ActionAutovacuumTune = "Tune autovacuum"
+)
+
+// Thresholds triggering the recommendations
+const (
+	// Dead tuples ratio above which a VACUUM is worth running
+	vacuumDeadRatio = 0.1
+	// Dead tuples ratio above the default autovacuum_vacuum_scale_factor,
+	// autovacuum isn't keeping up
+	autovacuumDeadRatio = 0.2
+	// Fraction of blocks not all-visible above which index only scans and
+	// anti-wraparound vacuums suffer
+	vacuumNotVisibleRatio = 0.5
+	// Reclaimable fraction above which a rewrite is worth its exclusive
+	// lock or extra disk space
+	rewriteReclaimableRatio = 0.5
+	// Minimum relation size for a rewrite or reindex to matter
+	rewriteMinBlocks = 128
+	// Average leaf density under which a btree index is rebuilt
+	reindexLeafDensity = 50
+	// Fraction of full blocks above which updates can't stay on their page
+	fillfactorFullRatio = 0.5
+	// Dead tuples ratio hinting the table is updated
+	fillfactorDeadRatio = 0.05
+	// Bounds of the recommended fillfactor
+	minRecommendedFillfactor = 50
+	maxRecommendedFillfactor = 95
+)
+
+// Identifiers that don't need quoting, keywords aside
+var plainIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+// Recommendation is a maintenance action on a relation with the evidence
+// that triggered it
+type Recommendation struct {
+	Action   string `json:"action"`
+	Relation string `json:"relation"`
+	// Statement or setting to apply
+	Command string `json:"command"`
+	// Higher scores are more urgent
+	Score    float64  `json:"score"`
+	Evidence []string `json:"evidence"`
+}
+
+func (r *Recommendation) String() string {
+	return fmt.Sprintf("%s on %s: %s", r.Action, r.Relation, r.Command)
+}
+
+// quoteIdent quotes an identifier like quote_ident
+func quoteIdent(name string) string {
+	if plainIdentifier.MatchString(name) {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// GetQualifiedName returns the relation's name usable in a statement,
+// quoting its name when the qualified name wasn't fetched
+func (r *Relation) GetQualifiedName() string {
+	if r.QualifiedName != "" {
+		return r.QualifiedName
+	}
+	return quoteIdent(r.Name)
+}
+
+// getRecommendedFillfactor returns a fillfactor leaving room on each page
+// for the fraction of tuples updated between vacuums, approximated by the
+// dead tuples ratio, rounded down to a multiple of 5
+func getRecommendedFillfactor(deadRatio float64) int {
+	fillfactor := int((1-deadRatio)*100) / 5 * 5
+	return max(minRecommendedFillfactor, min(fillfactor, maxRecommendedFillfactor))
+}
+
+// getDeadRatio returns the fraction of dead tuples of a heap, from
+// pgstattuple when available or from the per-block tuple counts
+func (r *Relation) getDeadRatio() (ratio float64, evidence string, ok bool) {
+	if r.TupleStats != nil {
+		ratio = r.TupleStats.DeadTuplePercent / 100
+		return ratio, fmt.Sprintf("%d dead tuples, %.1f%% of the heap (pgstattuple)",
+			r.TupleStats.DeadTupleCount, r.TupleStats.DeadTuplePercent), true
+	}
+	if r.Tuples == nil {
+		return 0, "", false
+	}
+	live, dead := 0, 0
+	for _, t := range r.Tuples {
+		live += t.Live
+		dead += t.Dead
+	}
+	if live+dead == 0 {
+		return 0, "", false
+	}
+	ratio = float64(dead) / float64(live+dead)
+	return ratio, fmt.Sprintf("%d dead tuples for %d live tuples (%.1f%%)", dead, live, ratio*100), true
+}
+
+// getNotVisibleRatio returns the fraction of blocks not marked all-visible
+// in the visibility map
+func (r *Relation) getNotVisibleRatio() (float64, bool) {
+	if r.AllVisible == nil || r.GetNumbBuffers() == 0 {
+		return 0, false
+	}
+	notVisible := 0
+	for _, visible := range r.AllVisible {
+		if !visible {
+			notVisible++
+		}
+	}
+	return float64(notVisible) / float64(r.GetNumbBuffers()), true
+}
+
+// getFullRatio returns the fraction of blocks without free space in the FSM
+func (r *Relation) getFullRatio() float64 {
+	if r.GetNumbBuffers() == 0 {
+		return 0
+	}
+	full := 0
+	for _, avail := range r.Fsm {
+		if avail == 0 {
+			full++
+		}
+	}
+	return float64(full) / float64(r.GetNumbBuffers())
+}
+
+// recommendHeap checks the table's heap or toast relation. Rewrites and
+// storage parameters of a toast relation go through its table, given by
+// its qualified name.
+func (r *Relation) recommendHeap(table string, isToast bool) []Recommendation {
+	prefix := ""
+	if isToast {
+		prefix = "toast."
+	}
+	recommendations := make([]Recommendation, 0)
+	bloat := r.GetBloat()
+	deadRatio, deadEvidence, hasDead := r.getDeadRatio()
+	notVisibleRatio, hasVisibility := r.getNotVisibleRatio()
+
+	vacuum := Recommendation{Action: ActionVacuum, Relation: r.Name,
+		Command: fmt.Sprintf("VACUUM (VERBOSE) %s;", r.GetQualifiedName())}
+	if hasDead && deadRatio >= vacuumDeadRatio {
+		vacuum.Score += deadRatio
+		vacuum.Evidence = append(vacuum.Evidence, deadEvidence)
+	}
+	if bloat.TruncatableBlocks > 0 {
+		vacuum.Score += float64(bloat.TruncatableBlocks) / float64(bloat.Blocks)
+		evidence := fmt.Sprintf("%d empty trailing blocks (%s) can be truncated",
+			bloat.TruncatableBlocks, FormatSize(int64(bloat.TruncatableBlocks)*BlockSize))
+		if bloat.FsmEstimate {
+			evidence += ", estimated from the FSM"
+		}
+		vacuum.Evidence = append(vacuum.Evidence, evidence)
+	}
+	if hasVisibility && notVisibleRatio >= vacuumNotVisibleRatio {
+		vacuum.Score += notVisibleRatio / 2
+		vacuum.Evidence = append(vacuum.Evidence,
+			fmt.Sprintf("%.1f%% of the blocks are not all-visible in the visibility map", notVisibleRatio*100))
+	}
+	if len(vacuum.Evidence) > 0 {
+		recommendations = append(recommendations, vacuum)
+	}
+
+	// Space VACUUM truncates doesn't need a rewrite
+	reclaimable := bloat.GetReclaimable() - int64(bloat.TruncatableBlocks)*BlockSize
+	reclaimableRatio := 0.0
+	if bloat.Blocks > 0 {
+		reclaimableRatio = float64(reclaimable) / float64(bloat.GetSize())
+	}
+	if bloat.Blocks >= rewriteMinBlocks && reclaimableRatio >= rewriteReclaimableRatio {
+		recommendations = append(recommendations, Recommendation{
+			Action:   ActionVacuumFull,
+			Relation: r.Name,
+			Command: fmt.Sprintf("pg_repack --table %s, or VACUUM FULL %s; which locks the table",
+				table, table),
+			Score: reclaimableRatio,
+			Evidence: []string{fmt.Sprintf("%s of %s reclaimable (%.1f%%) in the middle of the relation",
+				FormatSize(reclaimable), FormatSize(bloat.GetSize()), reclaimableRatio*100)},
+		})
+	}
+
+	fullRatio := r.getFullRatio()
+	// Toast chunks are never updated in place
+	if !isToast && hasDead && deadRatio >= fillfactorDeadRatio && fullRatio >= fillfactorFullRatio {
+		fillfactor := getRecommendedFillfactor(deadRatio)
+		recommendations = append(recommendations, Recommendation{
+			Action:   ActionFillfactor,
+			Relation: r.Name,
+			Command: fmt.Sprintf("ALTER TABLE %s SET (fillfactor = %d); only new pages use it until the table is rewritten, preview the rewrite with the fillfactor simulation",
+				table, fillfactor),
+			Score: fullRatio * deadRatio,
+			Evidence: []string{
+				fmt.Sprintf("%.1f%% of the blocks have no free space left for HOT updates", fullRatio*100),
+				deadEvidence,
+				fmt.Sprintf("fillfactor %d leaves room for the %.1f%% of tuples updated between vacuums", fillfactor, deadRatio*100),
+			},
+		})
+	}
+
+	if hasDead && deadRatio >= autovacuumDeadRatio {
+		recommendations = append(recommendations, Recommendation{
+			Action:   ActionAutovacuumTune,
+			Relation: r.Name,
+			Command: fmt.Sprintf("ALTER TABLE %s SET (%sautovacuum_vacuum_scale_factor = 0.05);",
+				table, prefix),
+			Score: deadRatio - autovacuumDeadRatio,
+			Evidence: []string{deadEvidence,
+				"dead tuples exceed the default autovacuum_vacuum_scale_factor of 20%"},
+		})
+	}
+	return recommendations
+}
+
+// recommendIndex checks the density of an index
+func (r *Relation) recommendIndex() []Recommendation {
+	bloat := r.GetBloat()
+	if bloat.Blocks < rewriteMinBlocks {
+		return nil
+	}
+	reindex := Recommendation{Action: ActionReindex, Relation: r.Name,
+		Command: fmt.Sprintf("REINDEX INDEX CONCURRENTLY %s;", r.GetQualifiedName())}
+	if r.IndexStats != nil && r.IndexStats.AvgLeafDensity < reindexLeafDensity {
+		reindex.Score = 1 - r.IndexStats.AvgLeafDensity/100
+		reindex.Evidence = append(reindex.Evidence, fmt.Sprintf("average leaf density %.1f%%, %d deleted pages (pgstatindex)",
+			r.IndexStats.AvgLeafDensity, r.IndexStats.DeletedPages))
+	} else if r.IndexStats == nil && bloat.GetReclaimablePercent() >= rewriteReclaimableRatio*100 {
+		reindex.Score = bloat.GetReclaimablePercent() / 100
+		evidence := fmt.Sprintf("%s of %s reclaimable (%.1f%%), %d empty pages",
+			FormatSize(bloat.GetReclaimable()), FormatSize(bloat.GetSize()),
+			bloat.GetReclaimablePercent(), bloat.EmptyBlocks)
+		if bloat.FsmOnly {
+			evidence += ", estimated from the FSM only"
+		}
+		reindex.Evidence = append(reindex.Evidence, evidence)
+	}
+	if len(reindex.Evidence) == 0 {
+		return nil
+	}
+	return []Recommendation{reindex}
+}
+
+// GetRecommendations returns the maintenance actions for the table's
+// relations, the most urgent first
+func (t *Table) GetRecommendations() []Recommendation {
+	recommendations := make([]Recommendation, 0)
+	table := t.GetQualifiedName()
+	recommendations = append(recommendations, t.recommendHeap(table, false)...)
+	for _, index := range t.Indexes {
+		recommendations = append(recommendations, index.recommendIndex()...)
+	}
+	if t.Toast != nil {
+		recommendations = append(recommendations, t.Toast.recommendHeap(table, true)...)
+		recommendations = append(recommendations, t.Toast.Index.recommendIndex()...)
+	}
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		return recommendations[i].Score > recommendations[j].Score
+	})
+	return recommendations
+}
+
+// GetMissingEvidence lists the information the recommendations couldn't
+// use as it wasn't fetched
+func (t *Table) GetMissingEvidence() []string {
+	missing := make([]string, 0)
+	heaps := []*Relation{&t.Relation}
+	if t.Toast != nil {
+		heaps = append(heaps, &t.Toast.Relation)
+	}
+	for _, heap := range heaps {
+		if heap.Tuples == nil && heap.TupleStats == nil {
+			missing = append(missing, fmt.Sprintf("%s: dead tuples, needs tuples or statistics", heap.Name))
+		}
+		if heap.AllVisible == nil {
+			missing = append(missing, fmt.Sprintf("%s: visibility map, needs pg_visibility", heap.Name))
+		}
+	}
+	for _, index := range t.Indexes {
+		if index.IndexStats == nil && index.IndexPages == nil {
+			missing = append(missing, fmt.Sprintf("%s: index density, needs statistics or index pages", index.Name))
+		}
+	}
+	return missing
+}
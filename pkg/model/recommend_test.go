@@ -0,0 +1,73 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func getRecommendTestRelation(name string, numBlocks int) Relation {
+	r := Relation{Name: name, Fsm: make([]int16, numBlocks), Tuples: make([]TupleCount, numBlocks)}
+	for i := range r.Tuples {
+		r.Tuples[i] = TupleCount{Live: 50, LiveBytes: 5000}
+	}
+	return r
+}
+
+func TestRecommendations(t *testing.T) {
+	table := Table{Relation: getRecommendTestRelation("t", 200)}
+	require.Empty(t, table.GetRecommendations())
+
+	// Updates left dead tuples on full pages, the tail was emptied
+	for i := range table.Tuples {
+		table.Tuples[i].Dead = 20
+	}
+	for i := 190; i < 200; i++ {
+		table.Tuples[i] = TupleCount{}
+		table.Fsm[i] = MaxFreeSpace
+	}
+	table.Indexes = []Relation{{Name: "t_idx", AccessMethod: "btree", Fsm: make([]int16, 200),
+		IndexStats: &IndexStats{AvgLeafDensity: 30, DeletedPages: 12}}}
+
+	recommendations := table.GetRecommendations()
+	actions := make([]string, len(recommendations))
+	for i, r := range recommendations {
+		actions[i] = r.Action
+		require.NotEmpty(t, r.Evidence)
+	}
+	require.Equal(t, []string{ActionReindex, ActionVacuum, ActionFillfactor, ActionAutovacuumTune}, actions)
+	require.Equal(t, "t_idx", recommendations[0].Relation)
+	require.Len(t, recommendations[1].Evidence, 2)
+	require.Contains(t, recommendations[2].Command, "ALTER TABLE t SET (fillfactor = 70);")
+	require.Contains(t, recommendations[2].Command, "only new pages use it")
+	require.Equal(t, []string{"t: visibility map, needs pg_visibility"}, table.GetMissingEvidence())
+}
+
+func TestRecommendRewrite(t *testing.T) {
+	table := Table{Relation: getRecommendTestRelation("t", 200)}
+	table.Toast = &Toast{Relation: getRecommendTestRelation("pg_toast.pg_toast_1", 10)}
+	for i := 0; i < 150; i++ {
+		table.Tuples[i] = TupleCount{}
+		table.Fsm[i] = MaxFreeSpace
+	}
+	recommendations := table.GetRecommendations()
+	require.Len(t, recommendations, 1)
+	require.Equal(t, ActionVacuumFull, recommendations[0].Action)
+	require.Contains(t, recommendations[0].Command, "pg_repack --table t")
+	require.Equal(t, []string{
+		"t: visibility map, needs pg_visibility",
+		"pg_toast.pg_toast_1: visibility map, needs pg_visibility",
+	}, table.GetMissingEvidence())
+}
+
+func TestQualifiedName(t *testing.T) {
+	plain := Relation{Name: "my_table"}
+	require.Equal(t, "my_table", plain.GetQualifiedName())
+	mixedCase := Relation{Name: `My"Table`}
+	require.Equal(t, `"My""Table"`, mixedCase.GetQualifiedName())
+	fetched := Relation{Name: "Table", QualifiedName: `other."Table"`}
+	require.Equal(t, `other."Table"`, fetched.GetQualifiedName())
+	require.Equal(t, 70, getRecommendedFillfactor(0.28))
+	require.Equal(t, 95, getRecommendedFillfactor(0.01))
+	require.Equal(t, 50, getRecommendedFillfactor(0.9))
+}
@@ -0,0 +1,63 @@
+package model
+
+import "fmt"
+
+// TupleStats is the tuple level statistics of a heap returned by
+// pgstattuple, or estimated by pgstattuple_approx
+type TupleStats struct {
+	Approximate      bool    `json:"approximate"`
+	TableLen         int64   `json:"table_len"`
+	TupleCount       int64   `json:"tuple_count"`
+	TupleLen         int64   `json:"tuple_len"`
+	TuplePercent     float64 `json:"tuple_percent"`
+	DeadTupleCount   int64   `json:"dead_tuple_count"`
+	DeadTupleLen     int64   `json:"dead_tuple_len"`
+	DeadTuplePercent float64 `json:"dead_tuple_percent"`
+	FreeSpace        int64   `json:"free_space"`
+	FreePercent      float64 `json:"free_percent"`
+}
+
+// IndexStats is the statistics of a btree index returned by pgstatindex
+type IndexStats struct {
+	TreeLevel         int     `json:"tree_level"`
+	IndexSize         int64   `json:"index_size"`
+	InternalPages     int64   `json:"internal_pages"`
+	LeafPages         int64   `json:"leaf_pages"`
+	EmptyPages        int64   `json:"empty_pages"`
+	DeletedPages      int64   `json:"deleted_pages"`
+	AvgLeafDensity    float64 `json:"avg_leaf_density"`
+	LeafFragmentation float64 `json:"leaf_fragmentation"`
+}
+
+// RelationStats is the statistics of one of the table's relations
+type RelationStats struct {
+	Relation string      `json:"relation"`
+	Tuples   *TupleStats `json:"tuples,omitempty"`
+	Index    *IndexStats `json:"index,omitempty"`
+}
+
+func (s *TupleStats) String() string {
+	method := "pgstattuple"
+	if s.Approximate {
+		method = "pgstattuple_approx"
+	}
+	return fmt.Sprintf("%s: %d bytes, %d live tuples (%.1f%%), %d dead tuples (%.1f%%), %d bytes free (%.1f%%)",
+		method, s.TableLen, s.TupleCount, s.TuplePercent, s.DeadTupleCount, s.DeadTuplePercent,
+		s.FreeSpace, s.FreePercent)
+}
+
+func (s *IndexStats) String() string {
+	return fmt.Sprintf("pgstatindex: level %d, %d leaf pages, %d empty, %d deleted, leaf density %.1f%%, fragmentation %.1f%%",
+		s.TreeLevel, s.LeafPages, s.EmptyPages, s.DeletedPages, s.AvgLeafDensity, s.LeafFragmentation)
+}
+
+// GetStats returns the statistics of the table's relations having some
+func (t *Table) GetStats() []RelationStats {
+	stats := make([]RelationStats, 0)
+	for _, relation := range t.GetRelations() {
+		if relation.TupleStats != nil || relation.IndexStats != nil {
+			stats = append(stats, RelationStats{relation.Name, relation.TupleStats, relation.IndexStats})
+		}
+	}
+	return stats
+}
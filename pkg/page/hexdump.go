@@ -0,0 +1,138 @@
+package page
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const bytesPerLine = 16
+
+// ANSI colors of each kind in the terminal hex dump
+var kindColors = map[Kind]string{
+	KindHeader:      "\033[34m",
+	KindLinePointer: "\033[36m",
+	KindFree:        "\033[32m",
+	KindUnused:      "\033[90m",
+	KindTupleHeader: "\033[33m",
+	KindNullBitmap:  "\033[35m",
+	KindTupleData:   "\033[37m",
+	KindSpecial:     "\033[31m",
+}
+
+const colorReset = "\033[0m"
+
+// HexByte is a byte of the page with the range it belongs to
+type HexByte struct {
+	Value byte
+	Range *Range
+}
+
+// HexLine is a line of the hex dump
+type HexLine struct {
+	Offset int
+	Bytes  []HexByte
+}
+
+func (b HexByte) Hex() string {
+	return fmt.Sprintf("%02x", b.Value)
+}
+
+func (b HexByte) Kind() Kind {
+	if b.Range == nil {
+		return ""
+	}
+	return b.Range.Kind
+}
+
+func (b HexByte) Label() string {
+	if b.Range == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s [%d-%d)", b.Range.Label, b.Range.Start, b.Range.End)
+}
+
+// GetHexLines splits the page in lines of 16 bytes annotated with their range
+func GetHexLines(raw []byte, ranges []Range) []HexLine {
+	byteRanges := make([]*Range, len(raw))
+	for i := range ranges {
+		for offset := ranges[i].Start; offset < ranges[i].End; offset++ {
+			if byteRanges[offset] == nil {
+				byteRanges[offset] = &ranges[i]
+			}
+		}
+	}
+	lines := make([]HexLine, 0, (len(raw)+bytesPerLine-1)/bytesPerLine)
+	for offset := 0; offset < len(raw); offset += bytesPerLine {
+		line := HexLine{Offset: offset}
+		for i := offset; i < min(offset+bytesPerLine, len(raw)); i++ {
+			line.Bytes = append(line.Bytes, HexByte{raw[i], byteRanges[i]})
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func isSameBytes(a []HexByte, b []HexByte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Value != b[i].Value || a[i].Range != b[i].Range {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteHexDump writes an annotated hex dump of the page followed by the
+// list of ranges. Identical consecutive lines are collapsed like hexdump.
+func WriteHexDump(w io.Writer, raw []byte, ranges []Range, color bool) error {
+	var sb strings.Builder
+	lines := GetHexLines(raw, ranges)
+	collapsed := false
+	for i, line := range lines {
+		if i > 0 && i < len(lines)-1 && isSameBytes(line.Bytes, lines[i-1].Bytes) {
+			if !collapsed {
+				sb.WriteString("*\n")
+				collapsed = true
+			}
+			continue
+		}
+		collapsed = false
+		fmt.Fprintf(&sb, "%04x  ", line.Offset)
+		for _, b := range line.Bytes {
+			if color {
+				sb.WriteString(kindColors[b.Kind()])
+			}
+			sb.WriteString(b.Hex())
+			if color {
+				sb.WriteString(colorReset)
+			}
+			sb.WriteString(" ")
+		}
+		sb.WriteString(" |")
+		for _, b := range line.Bytes {
+			if b.Value >= 0x20 && b.Value < 0x7f {
+				sb.WriteByte(b.Value)
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteString("|\n")
+	}
+
+	sb.WriteString("\n")
+	for _, r := range ranges {
+		if color {
+			sb.WriteString(kindColors[r.Kind])
+		}
+		fmt.Fprintf(&sb, "%04x-%04x %-13s %s", r.Start, r.End, r.Kind, r.Label)
+		if color {
+			sb.WriteString(colorReset)
+		}
+		sb.WriteString("\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,181 @@
+package page
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/rotisserie/eris"
+)
+
+// Kind is the type of structure stored in a byte range of a page
+type Kind string
+
+const (
+	KindHeader      Kind = "header"
+	KindLinePointer Kind = "line-pointer"
+	KindFree        Kind = "free"
+	KindTupleHeader Kind = "tuple-header"
+	KindNullBitmap  Kind = "null-bitmap"
+	KindTupleData   Kind = "tuple-data"
+	KindUnused      Kind = "unused"
+	KindSpecial     Kind = "special"
+)
+
+// Kinds lists all kinds in the order they are usually found in a page
+var Kinds = []Kind{KindHeader, KindLinePointer, KindFree, KindUnused,
+	KindTupleHeader, KindNullBitmap, KindTupleData, KindSpecial}
+
+const (
+	indexTupleHeaderSize = 8
+	indexHasNulls        = 0x8000
+	indexSizeMask        = 0x1FFF
+	// Size of an index tuple's null bitmap, INDEX_MAX_KEYS bits
+	indexNullBitmapSize = 4
+	maxAlign            = 8
+)
+
+// Range is a labelled range of bytes [Start, End) of a page
+type Range struct {
+	Start int
+	End   int
+	Kind  Kind
+	Label string
+}
+
+// LinePointer is a decoded ItemIdData
+type LinePointer struct {
+	Offset int
+	Flags  int
+	Length int
+}
+
+func maxAlignSize(size int) int {
+	return (size + maxAlign - 1) &^ (maxAlign - 1)
+}
+
+func getUint16(raw []byte, offset int) int {
+	return int(binary.LittleEndian.Uint16(raw[offset:]))
+}
+
+func getLinePointer(raw []byte, offset int) LinePointer {
+	v := binary.LittleEndian.Uint32(raw[offset:])
+	return LinePointer{
+		Offset: int(v & 0x7FFF),
+		Flags:  int((v >> 15) & 0x03),
+		Length: int(v >> 17),
+	}
+}
+
+// decoder accumulates the ranges found in a page
+type decoder struct {
+	raw    []byte
+	ranges []Range
+}
+
+func (d *decoder) add(start int, end int, kind Kind, label string) {
+	start = max(0, min(start, len(d.raw)))
+	end = max(start, min(end, len(d.raw)))
+	if end > start {
+		d.ranges = append(d.ranges, Range{start, end, kind, label})
+	}
+}
+
+func (d *decoder) decodeHeapTuple(lp int, item LinePointer) {
+	end := item.Offset + item.Length
+	if item.Length < model.HeapTupleHeaderSize {
+		d.add(item.Offset, end, KindTupleData, fmt.Sprintf("Truncated tuple (lp %d)", lp))
+		return
+	}
+	infomask2 := getUint16(d.raw, item.Offset+18)
+	infomask := getUint16(d.raw, item.Offset+20)
+	hoff := int(d.raw[item.Offset+22])
+	d.add(item.Offset, item.Offset+model.HeapTupleHeaderSize, KindTupleHeader,
+		fmt.Sprintf("Tuple header (lp %d, t_infomask 0x%04x, t_infomask2 0x%04x, t_hoff %d)", lp, infomask, infomask2, hoff))
+	bitmapEnd := item.Offset + model.HeapTupleHeaderSize
+	if infomask&model.HeapHasNull != 0 {
+		natts := infomask2 & model.HeapNattsMask
+		bitmapEnd += (natts + 7) / 8
+		d.add(item.Offset+model.HeapTupleHeaderSize, bitmapEnd, KindNullBitmap,
+			fmt.Sprintf("Null bitmap (lp %d, %d attributes)", lp, natts))
+	}
+	d.add(bitmapEnd, item.Offset+hoff, KindTupleHeader, fmt.Sprintf("Tuple header padding (lp %d)", lp))
+	d.add(item.Offset+hoff, end, KindTupleData, fmt.Sprintf("Tuple data (lp %d, %d bytes)", lp, end-item.Offset-hoff))
+}
+
+func (d *decoder) decodeIndexTuple(lp int, item LinePointer) {
+	end := item.Offset + item.Length
+	if item.Length < indexTupleHeaderSize {
+		d.add(item.Offset, end, KindTupleData, fmt.Sprintf("Truncated index tuple (lp %d)", lp))
+		return
+	}
+	info := getUint16(d.raw, item.Offset+6)
+	d.add(item.Offset, item.Offset+indexTupleHeaderSize, KindTupleHeader,
+		fmt.Sprintf("Index tuple header (lp %d, size %d)", lp, info&indexSizeMask))
+	dataOffset := item.Offset + indexTupleHeaderSize
+	if info&indexHasNulls != 0 {
+		d.add(dataOffset, dataOffset+indexNullBitmapSize, KindNullBitmap, fmt.Sprintf("Null bitmap (lp %d)", lp))
+		dataOffset = item.Offset + maxAlignSize(indexTupleHeaderSize+indexNullBitmapSize)
+	}
+	d.add(dataOffset, end, KindTupleData, fmt.Sprintf("Index tuple data (lp %d, %d bytes)", lp, end-dataOffset))
+}
+
+// addUnused labels the bytes of the tuple area not covered by a tuple
+func (d *decoder) addUnused(upper int, special int) {
+	covered := make([]bool, len(d.raw))
+	for _, r := range d.ranges {
+		for i := r.Start; i < r.End; i++ {
+			covered[i] = true
+		}
+	}
+	start := -1
+	for i := upper; i <= special && i <= len(d.raw); i++ {
+		free := i < special && i < len(d.raw) && !covered[i]
+		if free && start < 0 {
+			start = i
+		} else if !free && start >= 0 {
+			d.add(start, i, KindUnused, fmt.Sprintf("Unused space (%d bytes)", i-start))
+			start = -1
+		}
+	}
+}
+
+// Decode splits a raw page in labelled byte ranges. Heap and index pages
+// differ in their tuple headers. Inconsistent offsets are clamped to the
+// page so corrupted pages can still be inspected.
+func Decode(raw []byte, isHeap bool) ([]Range, error) {
+	if len(raw) < model.PageHeaderSize {
+		return nil, eris.Errorf("Page is too small: %d bytes", len(raw))
+	}
+	d := decoder{raw: raw}
+	lower := getUint16(raw, 12)
+	upper := getUint16(raw, 14)
+	special := getUint16(raw, 16)
+
+	d.add(0, model.PageHeaderSize, KindHeader,
+		fmt.Sprintf("Page header (pd_lower %d, pd_upper %d, pd_special %d)", lower, upper, special))
+	lp := 1
+	for offset := model.PageHeaderSize; offset+model.ItemIdSize <= min(lower, len(raw)); offset += model.ItemIdSize {
+		item := getLinePointer(raw, offset)
+		d.add(offset, offset+model.ItemIdSize, KindLinePointer,
+			fmt.Sprintf("Line pointer %d (lp_off %d, lp_flags %d, lp_len %d)", lp, item.Offset, item.Flags, item.Length))
+		hasStorage := item.Length > 0 && (item.Flags == model.LpNormal || item.Flags == model.LpDead)
+		if hasStorage && item.Offset+item.Length <= len(raw) {
+			if isHeap {
+				d.decodeHeapTuple(lp, item)
+			} else {
+				d.decodeIndexTuple(lp, item)
+			}
+		}
+		lp++
+	}
+	d.add(lower, upper, KindFree, fmt.Sprintf("Free space (%d bytes)", upper-lower))
+	d.add(special, len(raw), KindSpecial, fmt.Sprintf("Special space (%d bytes)", len(raw)-special))
+	d.addUnused(upper, special)
+
+	sort.SliceStable(d.ranges, func(i, j int) bool {
+		return d.ranges[i].Start < d.ranges[j].Start
+	})
+	return d.ranges, nil
+}
@@ -0,0 +1,64 @@
+package page
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+// getTestPage builds a heap page with a single tuple having a null bitmap
+func getTestPage() []byte {
+	raw := make([]byte, 8192)
+	binary.LittleEndian.PutUint16(raw[12:], 28)   // pd_lower
+	binary.LittleEndian.PutUint16(raw[14:], 8152) // pd_upper
+	binary.LittleEndian.PutUint16(raw[16:], 8192) // pd_special
+	// Line pointer 1: offset 8152, normal, length 40
+	binary.LittleEndian.PutUint32(raw[24:], uint32(8152|model.LpNormal<<15|40<<17))
+	binary.LittleEndian.PutUint16(raw[8152+18:], 3)                 // t_infomask2, 3 attributes
+	binary.LittleEndian.PutUint16(raw[8152+20:], model.HeapHasNull) // t_infomask
+	raw[8152+22] = 24                                               // t_hoff
+	return raw
+}
+
+func TestDecodeHeapPage(t *testing.T) {
+	ranges, err := Decode(getTestPage(), true)
+	require.NoError(t, err)
+
+	kinds := make([]Kind, 0)
+	for _, r := range ranges {
+		kinds = append(kinds, r.Kind)
+	}
+	require.Equal(t, []Kind{KindHeader, KindLinePointer, KindFree,
+		KindTupleHeader, KindNullBitmap, KindTupleData}, kinds)
+	require.Equal(t, Range{8152 + 23, 8152 + 24, KindNullBitmap, "Null bitmap (lp 1, 3 attributes)"}, ranges[4])
+	require.Equal(t, 8192, ranges[5].End)
+}
+
+func TestDecodeCorruptedPage(t *testing.T) {
+	raw := getTestPage()
+	// pd_lower and line pointer beyond the page
+	binary.LittleEndian.PutUint16(raw[12:], 9000)
+	binary.LittleEndian.PutUint32(raw[24:], uint32(8180|model.LpNormal<<15|100<<17))
+	ranges, err := Decode(raw, true)
+	require.NoError(t, err)
+	for _, r := range ranges {
+		require.LessOrEqual(t, r.End, len(raw))
+	}
+
+	_, err = Decode(raw[:10], true)
+	require.Error(t, err)
+}
+
+func TestWriteHexDump(t *testing.T) {
+	raw := getTestPage()
+	ranges, err := Decode(raw, true)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, WriteHexDump(&buf, raw, ranges, false))
+	require.Contains(t, buf.String(), "0000  00 00 00 00")
+	require.Contains(t, buf.String(), "*\n")
+	require.Contains(t, buf.String(), "1fd8-1fef tuple-header")
+}
@@ -0,0 +1,55 @@
+package render
+
+import (
+	"bufio"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+
+	"github.com/bonnefoa/pg_buffer_viz/pkg/util"
+	"github.com/sirupsen/logrus"
+)
+
+var backgroundColor = color.RGBA{0xee, 0xee, 0xee, 0xff}
+
+type CanvasPng struct {
+	*image.RGBA
+	file *os.File
+}
+
+func NewCanvasPng(filename string) *CanvasPng {
+	var c CanvasPng
+	var err error
+
+	c.file, err = os.Create(filename)
+	util.FatalIf(err)
+	return &c
+}
+
+// FsmColor returns the color of a FSM bucket, matching the fsm classes of
+// the SVG stylesheet
+func FsmColor(fsmBucket int) color.RGBA {
+	return color.RGBA{uint8(255 - fsmBucket), uint8(fsmBucket), 0, 0xff}
+}
+
+func (c *CanvasPng) Start(width int, height int) {
+	c.RGBA = image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(c.RGBA, c.Bounds(), &image.Uniform{backgroundColor}, image.Point{}, draw.Src)
+}
+
+func (c *CanvasPng) Rect(x int, y int, w int, h int, col color.Color) {
+	draw.Draw(c.RGBA, image.Rect(x, y, x+w, y+h), &image.Uniform{col}, image.Point{}, draw.Src)
+}
+
+func (c *CanvasPng) End() {
+	logrus.Infof("Encoding png file")
+	bw := bufio.NewWriter(c.file)
+	err := png.Encode(bw, c.RGBA)
+	util.FatalIf(err)
+	err = bw.Flush()
+	util.FatalIf(err)
+	err = c.file.Close()
+	util.FatalIf(err)
+}
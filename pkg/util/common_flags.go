@@ -20,6 +20,8 @@ func SetCommonCliFlags(fs *pflag.FlagSet, defaultLogLevel string) {
 	fs.Int("block-height", 10, "Height of a block")
 	fs.Int("margin-width", 3, "Width margin in block between elements")
 	fs.Int("margin-height", 3, "Height margin in block between elements")
+	fs.Int("max-cells", 100000, "Maximum number of cells to draw, consecutive blocks are aggregated above it. 0 disables aggregation")
+	fs.String("layout", "row", "Layout of blocks: row, hilbert or segment")
 	fs.Duration("timeout", 5*time.Second, "Timeout")
 }
 
@@ -39,6 +41,14 @@ func GetMarginSize() model.Size {
 	return res
 }
 
+func GetMaxCells() int {
+	return viper.GetInt("max-cells")
+}
+
+func GetLayoutName() string {
+	return viper.GetString("layout")
+}
+
 func CommonInitialization() {
 	configureLog()
 	cpuProfile := viper.GetString("cpu-profile")
@@ -1,37 +1,404 @@
 "use strict";
 var details,
   searchbtn,
-  unzoombtn,
   matchedtxt,
   svg,
+  tooltip,
   searching,
-  currentSearchTerm,
-  ignorecase,
-  ignorecaseBtn;
+  currentSearchTerm;
 
 function init(evt) {
     svg = document.getElementsByTagName("svg")[0];
     details = document.getElementById("details").firstChild;
+    tooltip = create_tooltip();
+    searchbtn = document.getElementById("search");
+    matchedtxt = document.getElementById("matched").firstChild;
+    searchbtn.addEventListener('click', search_prompt);
+    init_references();
 
     var blocks = document.getElementsByClassName("block");
 
     Array.from(blocks).forEach(function(element) {
         element.addEventListener('mouseover', block_mouseover);
+        element.addEventListener('mousemove', block_mousemove);
         element.addEventListener('mouseout', block_mouseout);
+        element.addEventListener('click', block_click);
     });
 }
 
 function block_mouseover(e) {
     var block = e.currentTarget;
     block.classList.add("selected");
-    var block_id = block_to_id(block);
-    details.nodeValue = "Details: Block " + block_id;
+    details.nodeValue = "Details: " + block_range(block) + ", " + block_free(block);
+    var lines = block_details(block);
+    var referencing = highlight_references(block);
+    if (block.dataset.next != undefined)
+        lines.push("Chain of " + referencing + " linked pages");
+    else if (block.dataset.refs == undefined && referencing > 0)
+        lines.push("Referenced from " + referencing + " index cells");
+    show_tooltip(lines, e);
+}
+
+function block_mousemove(e) {
+    move_tooltip(e);
 }
 
 function block_mouseout(e) {
     var block = e.currentTarget;
     block.classList.remove("selected");
+    reset_references();
     details.nodeValue = "Details: ";
+    tooltip.classList.add("hide");
+}
+
+// Open the page inspector of the block, only available when served
+function block_click(e) {
+    if (!window.location.protocol.startsWith("http"))
+        return;
+    var block = e.currentTarget;
+    var relation = find_group(block).dataset.relation;
+    window.location.href = "/buffer_viz/" + encodeURIComponent(relation) + "/block/" + block.dataset.start;
+}
+
+// tooltip
+var SVG_NS = "http://www.w3.org/2000/svg";
+var BLOCK_SIZE = 8192;
+var BLOCKS_PER_SEGMENT = 131072;
+var TOOLTIP_LINE_HEIGHT = 14;
+
+function create_tooltip() {
+  var group = document.createElementNS(SVG_NS, "g");
+  group.id = "tooltip";
+  group.classList.add("hide");
+  group.appendChild(document.createElementNS(SVG_NS, "rect"));
+  group.appendChild(document.createElementNS(SVG_NS, "text"));
+  svg.appendChild(group);
+  return group;
+}
+
+function show_tooltip(lines, e) {
+  var text = find_child(tooltip, "text");
+  while (text.firstChild)
+    text.removeChild(text.firstChild);
+  lines.forEach(function(line, i) {
+    var tspan = document.createElementNS(SVG_NS, "tspan");
+    tspan.setAttribute("x", 6);
+    tspan.setAttribute("y", (i + 1) * TOOLTIP_LINE_HEIGHT);
+    tspan.textContent = line;
+    text.appendChild(tspan);
+  });
+  tooltip.classList.remove("hide");
+  var box = text.getBBox();
+  var rect = find_child(tooltip, "rect");
+  rect.setAttribute("width", box.width + 12);
+  rect.setAttribute("height", box.height + 8);
+  move_tooltip(e);
+}
+
+function move_tooltip(e) {
+  var point = svg.createSVGPoint();
+  point.x = e.clientX;
+  point.y = e.clientY;
+  point = point.matrixTransform(svg.getScreenCTM().inverse());
+  var rect = find_child(tooltip, "rect");
+  var width = parseFloat(rect.getAttribute("width"));
+  var x = point.x + 12;
+  // Keep the tooltip inside the drawing
+  if (x + width > svg.width.baseVal.value)
+    x = point.x - width - 12;
+  tooltip.setAttribute("transform", "translate(" + x + "," + (point.y + 12) + ")");
+}
+
+function block_details(node) {
+  var data = node.dataset;
+  var relation = find_group(node);
+  var numBlocks = data.end - data.start + 1;
+  var lines = [relation.dataset.relation];
+  if (relation.dataset.summary != undefined)
+    lines.push(relation.dataset.summary);
+  lines.push(
+    block_range(node),
+    block_file(relation, data.start),
+    block_free(node) + ", FSM category " + Math.floor(data.avg / 32));
+  if (data.cached != undefined)
+    lines.push("Cached: " + block_count(data.cached, numBlocks));
+  if (data.visible != undefined)
+    lines.push("All visible: " + block_count(data.visible, numBlocks) +
+      ", all frozen: " + block_count(data.frozen, numBlocks));
+  if (data.live != undefined)
+    lines.push("Tuples: " + data.live + " live (" + data.bytes + " bytes), " + data.dead + " dead");
+  if (data.highlight != undefined)
+    lines.push(relation.dataset.highlightLabel + ": " + data.highlight);
+  if (data.truncatable != undefined)
+    lines.push("Empty tail, truncatable by VACUUM");
+  if (data.pageType != undefined)
+    lines.push("Page type: " + data.pageType + ", " + data.items + " items, " + data.deadItems + " dead");
+  if (data.pageFree != undefined)
+    lines.push(page_fill(data.pageFree, numBlocks));
+  if (data.flags != undefined)
+    lines.push("Flags: " + data.flags.split(",").join(", "));
+  if (data.next != undefined)
+    lines.push("Next page: " + data.next);
+  if (data.brin != undefined)
+    data.brin.split("|").forEach(function(line) { lines.push("BRIN " + line); });
+  if (data.refs != undefined)
+    lines.push("References " + ranges_count(parse_ranges(data.refs)) + " heap blocks of " + relation.dataset.heap);
+  return lines;
+}
+
+function block_count(count, numBlocks) {
+  if (numBlocks == 1)
+    return count == 1 ? "yes" : "no";
+  return count + "/" + numBlocks + " blocks";
+}
+
+function block_file(relation, block) {
+  var filepath = relation.dataset.filepath;
+  var segment = Math.floor(block / BLOCKS_PER_SEGMENT);
+  if (segment > 0)
+    filepath += "." + segment;
+  var offset = (block % BLOCKS_PER_SEGMENT) * BLOCK_SIZE;
+  return "File " + filepath + " at offset " + offset;
+}
+
+// cross highlighting between index blocks and the heap blocks they reference
+var relationCells = {};
+var referencingCells = [];
+
+function init_references() {
+  Array.from(document.getElementsByClassName("relation")).forEach(function(group) {
+    relationCells[group.dataset.relation] = Array.from(group.getElementsByClassName("block"));
+  });
+  Array.from(document.querySelectorAll(".block[data-refs]")).forEach(function(block) {
+    referencingCells.push({
+      block: block,
+      heap: find_group(block).dataset.heap,
+      ranges: parse_ranges(block.dataset.refs),
+    });
+  });
+}
+
+// parse_ranges converts "1-4,7" to [[1, 4], [7, 7]]
+function parse_ranges(refs) {
+  return refs.split(",").map(function(range) {
+    var bounds = range.split("-");
+    return [parseInt(bounds[0]), parseInt(bounds[bounds.length - 1])];
+  });
+}
+
+function ranges_count(ranges) {
+  return ranges.reduce(function(count, range) { return count + range[1] - range[0] + 1; }, 0);
+}
+
+// find_cell_index returns the position of the cell holding a block in the
+// relation's cells ordered by block, -1 when it's outside the relation
+function find_cell_index(cells, block) {
+  var low = 0;
+  var high = cells.length - 1;
+  while (low <= high) {
+    var mid = (low + high) >> 1;
+    if (block < parseInt(cells[mid].dataset.start))
+      high = mid - 1;
+    else if (block > parseInt(cells[mid].dataset.end))
+      low = mid + 1;
+    else
+      return mid;
+  }
+  return -1;
+}
+
+// highlight_references marks the heap cells referenced by a hovered index
+// cell, or the index cells referencing a hovered heap cell. It returns the
+// number of marked cells.
+function highlight_references(block) {
+  var group = find_group(block);
+  var marked = 0;
+  if (block.dataset.next != undefined)
+    return highlight_chain(block, relationCells[group.dataset.relation]);
+  if (block.dataset.refs != undefined) {
+    var cells = relationCells[group.dataset.heap] || [];
+    parse_ranges(block.dataset.refs).forEach(function(range) {
+      var i = find_cell_index(cells, range[0]);
+      for (; i >= 0 && i < cells.length && parseInt(cells[i].dataset.start) <= range[1]; i++) {
+        if (!cells[i].classList.contains("referenced"))
+          marked++;
+        cells[i].classList.add("referenced");
+      }
+    });
+    return marked;
+  }
+  var start = parseInt(block.dataset.start);
+  var end = parseInt(block.dataset.end);
+  referencingCells.forEach(function(ref) {
+    if (ref.heap != group.dataset.relation)
+      return;
+    var overlaps = ref.ranges.some(function(range) { return range[0] <= end && range[1] >= start; });
+    if (overlaps) {
+      ref.block.classList.add("referenced");
+      marked++;
+    }
+  });
+  return marked;
+}
+
+// highlight_chain marks the pages linked from a page, like the overflow
+// pages of a hash bucket
+function highlight_chain(block, cells) {
+  var marked = 0;
+  var next = block.dataset.next;
+  while (next != undefined) {
+    var i = find_cell_index(cells, parseInt(next));
+    if (i < 0 || cells[i].classList.contains("referenced"))
+      break;
+    cells[i].classList.add("referenced");
+    marked++;
+    next = cells[i].dataset.next;
+  }
+  return marked;
+}
+
+function reset_references() {
+  Array.from(document.getElementsByClassName("referenced")).forEach(function(element) {
+    element.classList.remove("referenced");
+  });
+}
+
+// search
+var SEARCH_HELP = "Filter blocks with conditions joined by 'and', e.g.\n" +
+  "free > 4kB, dead_ratio > 20%, cached = 0\n" +
+  "Fields: free, min_free, max_free, cached, visible, frozen, live, dead, dead_ratio, highlight, block, brin_overlaps, items, dead_items, page_free";
+var SEARCH_OPERATORS = {
+  ">=": function(a, b) { return a >= b; },
+  "<=": function(a, b) { return a <= b; },
+  "!=": function(a, b) { return a != b; },
+  "==": function(a, b) { return a == b; },
+  "=": function(a, b) { return a == b; },
+  ">": function(a, b) { return a > b; },
+  "<": function(a, b) { return a < b; },
+};
+var SEARCH_UNITS = { "": 1, "b": 1, "kb": 1024, "mb": 1024 * 1024, "%": 0.01 };
+
+function search_prompt() {
+  if (searching) {
+    reset_search();
+    return;
+  }
+  var term = prompt(SEARCH_HELP, currentSearchTerm || "");
+  if (term == null || term.trim() == "")
+    return;
+  search(term);
+}
+
+function reset_search() {
+  Array.from(document.getElementsByClassName("matched")).forEach(function(element) {
+    element.classList.remove("matched");
+  });
+  svg.classList.remove("searching");
+  searching = false;
+  searchbtn.firstChild.nodeValue = "Search";
+  matchedtxt.nodeValue = " ";
+}
+
+// parse_search converts a search term to a list of conditions
+function parse_search(term) {
+  return term.split(/\s+and\s+|\s*&&\s*/i).map(function(clause) {
+    var match = clause.trim().match(/^([a-z_]+)\s*(>=|<=|!=|==|=|>|<)\s*(-?[0-9.]+)\s*([a-z%]*)$/i);
+    if (!match)
+      throw "Invalid condition '" + clause + "'";
+    var unit = SEARCH_UNITS[match[4].toLowerCase()];
+    if (unit == undefined)
+      throw "Unknown unit '" + match[4] + "'";
+    return {
+      field: match[1].toLowerCase(),
+      operator: SEARCH_OPERATORS[match[2]],
+      value: parseFloat(match[3]) * unit,
+    };
+  });
+}
+
+// block_field returns the value of a field for a block, undefined when the
+// block doesn't have the information
+function block_field(node, field) {
+  var data = node.dataset;
+  var numBlocks = data.end - data.start + 1;
+  switch (field) {
+    case "free": return parseInt(data.avg);
+    case "min_free": return parseInt(data.min);
+    case "max_free": return parseInt(data.max);
+    case "block": return parseInt(data.start);
+    case "highlight": return data.highlight == undefined ? 0 : parseInt(data.highlight);
+    case "cached": return data.cached == undefined ? undefined : data.cached / numBlocks;
+    case "visible": return data.visible == undefined ? undefined : data.visible / numBlocks;
+    case "frozen": return data.frozen == undefined ? undefined : data.frozen / numBlocks;
+    case "live": return data.live == undefined ? undefined : parseInt(data.live);
+    case "dead": return data.dead == undefined ? undefined : parseInt(data.dead);
+    case "items": return data.items == undefined ? undefined : parseInt(data.items);
+    case "dead_items": return data.deadItems == undefined ? undefined : parseInt(data.deadItems);
+    case "page_free": return data.pageFree == undefined ? undefined : parseInt(data.pageFree);
+    case "brin_overlaps": return data.brinOverlaps == undefined ? undefined : parseInt(data.brinOverlaps);
+    case "dead_ratio":
+      if (data.dead == undefined)
+        return undefined;
+      var total = parseInt(data.live) + parseInt(data.dead);
+      return total == 0 ? 0 : data.dead / total;
+  }
+  throw "Unknown field '" + field + "'";
+}
+
+function search(term) {
+  var conditions;
+  try {
+    conditions = parse_search(term);
+    // Check fields before going through all blocks
+    var first = document.getElementsByClassName("block")[0];
+    conditions.forEach(function(c) { block_field(first, c.field); });
+  } catch (error) {
+    alert(error);
+    return;
+  }
+  reset_search();
+  currentSearchTerm = term;
+
+  // Matched and total blocks per relation
+  var matches = {};
+  Array.from(document.getElementsByClassName("block")).forEach(function(block) {
+    var relation = find_group(block).dataset.relation;
+    var numBlocks = block.dataset.end - block.dataset.start + 1;
+    if (!(relation in matches))
+      matches[relation] = { matched: 0, total: 0 };
+    matches[relation].total += numBlocks;
+    var matched = conditions.every(function(c) {
+      var value = block_field(block, c.field);
+      return value != undefined && c.operator(value, c.value);
+    });
+    if (matched) {
+      block.classList.add("matched");
+      matches[relation].matched += numBlocks;
+    }
+  });
+
+  searching = true;
+  svg.classList.add("searching");
+  searchbtn.firstChild.nodeValue = "Reset search";
+  matchedtxt.nodeValue = search_summary(term, matches);
+}
+
+function search_summary(term, matches) {
+  var matched = 0;
+  var total = 0;
+  var perRelation = [];
+  for (var relation in matches) {
+    var m = matches[relation];
+    matched += m.matched;
+    total += m.total;
+    if (m.matched > 0)
+      perRelation.push(relation + " " + (100 * m.matched / m.total).toFixed(1) + "%");
+  }
+  var summary = "'" + term + "': " + matched + "/" + total + " blocks (" +
+    (total == 0 ? 0 : 100 * matched / total).toFixed(1) + "%)";
+  if (perRelation.length > 0)
+    summary += ", " + perRelation.join(", ");
+  return summary;
 }
 
 // functions
@@ -49,10 +416,33 @@ function find_child(parent, name, attr) {
 function find_group(node) {
   var parent = node.parentElement;
   if (!parent) return;
-  if (parent.id == "frames") return node;
+  if (parent.classList.contains("relation")) return parent;
   return find_group(parent);
 }
 
 function block_to_id(node) {
   return node.id.split("_").at(-1)
 }
+
+function block_range(node) {
+  var start = node.dataset.start;
+  var end = node.dataset.end;
+  if (start == end)
+    return "Block " + start;
+  return "Blocks " + start + "-" + end + " (" + (end - start + 1) + " blocks)";
+}
+
+// page_fill describes the free space of index pages, averaged over the
+// cell's blocks
+function page_fill(pageFree, numBlocks) {
+  var fill = Math.round(100 * (1 - pageFree / 8168));
+  return "Page free space" + (numBlocks > 1 ? " avg " : " ") + pageFree + " bytes, " + fill + "% full";
+}
+
+function block_free(node) {
+  var data = node.dataset;
+  if (data.start == data.end)
+    return "free " + data.avg + " bytes";
+  return "free min/avg/max " + data.min + "/" + data.avg + "/" + data.max +
+    " bytes, " + data.full + " full, " + data.empty + " empty";
+}